@@ -17,24 +17,30 @@ import (
 )
 
 type BundleCmd struct {
-	Config       []string `short:"c" help:"Path to the configuration file or directory." type:"path"`
-	VarFile      []string `short:"v" help:"Path to the files containing variable values." type:"path"`
-	Image        string   `short:"f" help:"Path to the Flatcar Linux image." type:"existingpath" required:""`
-	GenIgnition  bool     `short:"g" help:"Generate the Ignition config. (cannot be used with --ignition)"`
-	Ignition     string   `short:"i" help:"Path to the Ignition config." type:"existingpath" optional:""`
-	Output       string   `short:"o" help:"Output file."`
-	ExtensionDir string   `short:"e" help:"Directory containing sysexts." type:"existingdir" optional:""`
+	Config       []string          `short:"c" help:"Path to the configuration file or directory." type:"path"`
+	VarFile      []string          `short:"v" help:"Path to the files containing variable values." type:"path"`
+	Var          map[string]string `help:"Set a variable value. (name=value)" mapsep:"none"`
+	KeyFile      []string          `help:"Path to an age identity file used to decrypt encrypted values." type:"path" env:"COLA_KEY_FILE"`
+	Image        string            `short:"f" help:"Path to the Flatcar Linux image." type:"existingpath" required:""`
+	GenIgnition  bool              `short:"g" help:"Generate the Ignition config. (cannot be used with --ignition)"`
+	Ignition     string            `short:"i" help:"Path to the Ignition config." type:"existingpath" optional:""`
+	Output       string            `short:"o" help:"Output file."`
+	ExtensionDir string            `short:"e" help:"Directory containing sysexts." type:"existingdir" optional:""`
 }
 
 func (cmd *BundleCmd) Run() error {
-	cfg, err := config.ReadConfig(cmd.Config, cmd.VarFile)
+	cfg, err := config.ReadConfig(cmd.Config, cmd.VarFile, config.WithVariables(cmd.Var), config.WithEnviron(os.Environ()), config.WithKeyFiles(cmd.KeyFile))
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to read configuration")
+		fatalConfigError(err, "Failed to read configuration")
 	}
 
-	err = config.ValidateConfig(cfg)
-	if err != nil {
-		log.Fatal().Err(err).Msg("failed to validate configuration")
+	diags := config.ValidateConfig(cfg)
+	if len(diags) > 0 {
+		config.WriteDiagnostics(os.Stderr, diags)
+	}
+
+	if diags.HasErrors() {
+		log.Fatal().Msg("failed to validate configuration")
 	}
 
 	workdir, err := os.MkdirTemp("", "cola-bundle")
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+type diffOp byte
+
+const (
+	diffEqual  diffOp = ' '
+	diffDelete diffOp = '-'
+	diffInsert diffOp = '+'
+)
+
+type diffEdit struct {
+	Op   diffOp
+	Line string
+}
+
+// unifiedDiff returns a unified diff between the lines of a and b, in the
+// format produced by diff -u. It is empty if a and b are equal.
+func unifiedDiff(oldName, newName string, a, b []byte) []byte {
+	edits := diffLines(splitLines(a), splitLines(b))
+
+	changes := make([]int, 0)
+	for i, edit := range edits {
+		if edit.Op != diffEqual {
+			changes = append(changes, i)
+		}
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+
+	// Changes separated by no more than twice the context share a hunk.
+	start := 0
+	for i := 1; i <= len(changes); i++ {
+		if i < len(changes) && changes[i]-changes[i-1] <= 2*diffContext+1 {
+			continue
+		}
+
+		first := max(changes[start]-diffContext, 0)
+		last := min(changes[i-1]+diffContext+1, len(edits))
+		writeHunk(&out, edits, first, last)
+		start = i
+	}
+
+	return out.Bytes()
+}
+
+// writeHunk writes the edits from first up to last as a single hunk.
+func writeHunk(out *bytes.Buffer, edits []diffEdit, first, last int) {
+	oldStart, newStart := 0, 0
+	for _, edit := range edits[:first] {
+		if edit.Op != diffInsert {
+			oldStart++
+		}
+		if edit.Op != diffDelete {
+			newStart++
+		}
+	}
+
+	oldCount, newCount := 0, 0
+	for _, edit := range edits[first:last] {
+		if edit.Op != diffInsert {
+			oldCount++
+		}
+		if edit.Op != diffDelete {
+			newCount++
+		}
+	}
+
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+
+	for _, edit := range edits[first:last] {
+		out.WriteByte(byte(edit.Op))
+		out.WriteString(edit.Line)
+		if len(edit.Line) == 0 || edit.Line[len(edit.Line)-1] != '\n' {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats the range of lines of a hunk, given the number of lines
+// before it and the number of lines within it.
+func hunkRange(before, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", before)
+	case 1:
+		return fmt.Sprintf("%d", before+1)
+	default:
+		return fmt.Sprintf("%d,%d", before+1, count)
+	}
+}
+
+// splitLines splits s after each newline. The last line has no newline if s
+// does not end with one.
+func splitLines(s []byte) []string {
+	lines := make([]string, 0)
+	for len(s) > 0 {
+		i := bytes.IndexByte(s, '\n') + 1
+		if i == 0 {
+			i = len(s)
+		}
+
+		lines = append(lines, string(s[:i]))
+		s = s[i:]
+	}
+
+	return lines
+}
+
+// diffLines finds the shortest sequence of edits that turns a into b, using
+// Myers' algorithm.
+func diffLines(a, b []string) []diffEdit {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+
+	// trace holds the furthest reaching paths at the start of each round,
+	// to walk the shortest path back once the end is reached.
+	trace := make([][]int, 0)
+
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, slices.Clone(v))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	edits := make([]diffEdit, 0, n+m)
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		prevK := k - 1
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		}
+
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			edits = append(edits, diffEdit{diffEqual, a[x-1]})
+			x--
+			y--
+		}
+
+		if prevK == k+1 {
+			edits = append(edits, diffEdit{diffInsert, b[prevY]})
+		} else {
+			edits = append(edits, diffEdit{diffDelete, a[prevX]})
+		}
+
+		x, y = prevX, prevY
+	}
+
+	for x > 0 && y > 0 {
+		edits = append(edits, diffEdit{diffEqual, a[x-1]})
+		x--
+		y--
+	}
+
+	slices.Reverse(edits)
+
+	return edits
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/rs/zerolog/log"
+)
+
+// fmtExtensions are the extensions of the files in native HCL syntax that
+// are formatted when a directory is given.
+var fmtExtensions = []string{".hcl", ".cvars", ".tfvars"}
+
+type FmtCmd struct {
+	Paths []string `arg:"" optional:"" help:"Files or directories to format. (default: current directory)" type:"path"`
+	Check bool     `help:"Check that files are formatted without changing them. Exits non-zero if any are not."`
+	Diff  bool     `help:"Display the formatting changes as a diff."`
+}
+
+func (cmd *FmtCmd) Run() error {
+	paths := cmd.Paths
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	files, err := findFmtFiles(paths)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to find files to format")
+	}
+
+	unformatted := 0
+	for _, path := range files {
+		changed, err := cmd.formatFile(path)
+		if err != nil {
+			fatalConfigError(err, "Failed to format file")
+		}
+
+		if changed {
+			unformatted++
+		}
+	}
+
+	if cmd.Check && unformatted > 0 {
+		log.Fatal().Int("files", unformatted).Msg("Files are not formatted")
+	}
+
+	return nil
+}
+
+// formatFile formats a single file, and reports whether its formatting
+// changed. The file is only rewritten if neither --check nor --diff is set.
+func (cmd *FmtCmd) formatFile(path string) (bool, error) {
+	// Files in JSON syntax have no canonical format.
+	if strings.HasSuffix(path, ".json") {
+		log.Warn().Str("file", path).Msg("Skipping file in JSON syntax")
+		return false, nil
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	_, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return false, diags
+	}
+
+	formatted := hclwrite.Format(src)
+	if bytes.Equal(src, formatted) {
+		return false, nil
+	}
+
+	fmt.Println(path)
+
+	if cmd.Diff {
+		label := strings.TrimPrefix(filepath.ToSlash(path), "/")
+		os.Stdout.Write(unifiedDiff("old/"+label, "new/"+label, src, formatted))
+	}
+
+	if cmd.Check || cmd.Diff {
+		return true, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	log.Debug().Str("file", path).Msg("Formatting file")
+
+	return true, os.WriteFile(path, formatted, info.Mode())
+}
+
+// findFmtFiles returns the files to format. Files given directly are always
+// formatted unless written in JSON syntax, directories are searched for files
+// with a known extension.
+func findFmtFiles(paths []string) ([]string, error) {
+	files := make([]string, 0)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !d.IsDir() && slices.Contains(fmtExtensions, filepath.Ext(p)) {
+				files = append(files, p)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
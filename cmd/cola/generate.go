@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"io"
 	"os"
 
@@ -10,11 +11,15 @@ import (
 )
 
 type GenerateCmd struct {
-	Config            []string `short:"c" help:"Path to the configuration file or directory." type:"path"`
-	VarFile           []string `short:"v" help:"Path to the files containing variable values." type:"path"`
-	Output            string   `short:"o" help:"Output file."`
-	BundledExtensions bool     `short:"b" help:"Assume extensions are will be bundled into the image."`
-	ExtensionDir      string   `short:"e" help:"Directory containing sysexts." type:"existingdir" optional:""`
+	Config            []string          `short:"c" help:"Path to the configuration file or directory." type:"path"`
+	VarFile           []string          `short:"v" help:"Path to the files containing variable values." type:"path"`
+	Var               map[string]string `help:"Set a variable value. (name=value)" mapsep:"none"`
+	KeyFile           []string          `help:"Path to an age identity file used to decrypt encrypted values." type:"path" env:"COLA_KEY_FILE"`
+	Inventory         string            `help:"Path to a hosts file or a directory of value files. Generates a config for each host into the output directory." type:"existingpath" optional:""`
+	Jobs              int               `short:"j" help:"Number of hosts to generate in parallel with --inventory. (default: number of CPUs)"`
+	Output            string            `short:"o" help:"Output file, or output directory with --inventory."`
+	BundledExtensions bool              `short:"b" help:"Assume extensions are will be bundled into the image."`
+	ExtensionDir      string            `short:"e" help:"Directory containing sysexts." type:"existingdir" optional:""`
 }
 
 func (cmd *GenerateCmd) Run() error {
@@ -22,36 +27,27 @@ func (cmd *GenerateCmd) Run() error {
 		log.Fatal().Msg("No configuration file specified")
 	}
 
-	cfg, err := config.ReadConfig(cmd.Config, cmd.VarFile)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to read configuration")
+	if cmd.Inventory != "" {
+		return cmd.runInventory()
 	}
 
-	err = config.ValidateConfig(cfg)
+	cfg, err := config.ReadConfig(cmd.Config, cmd.VarFile, config.WithVariables(cmd.Var), config.WithEnviron(os.Environ()), config.WithKeyFiles(cmd.KeyFile))
 	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to validate configuration")
+		fatalConfigError(err, "Failed to read configuration")
 	}
 
-	log.Trace().Interface("config", cfg).Msg("Configuration loaded")
-
-	opts := []ignition.GeneratorOpt{}
-	if cmd.BundledExtensions {
-		workdir, err := os.MkdirTemp("", "cola-generate")
-		if err != nil {
-			log.Fatal().Err(err).Msg("failed to create temporary directory")
-		}
-
-		defer os.RemoveAll(workdir)
-
-		err = fetchExtensionTransferConfigs(workdir, cmd.ExtensionDir, cfg)
-		if err != nil {
-			log.Fatal().Err(err).Msg("failed to fetch extension transfer configs")
-		}
+	diags := config.ValidateConfig(cfg)
+	if len(diags) > 0 {
+		config.WriteDiagnostics(os.Stderr, diags)
+	}
 
-		opts = append(opts, ignition.WithBundledExtensions(), ignition.WithExtensionDir(workdir))
+	if diags.HasErrors() {
+		log.Fatal().Msg("Failed to validate configuration")
 	}
 
-	ignJson, err := ignition.Generate(cfg, opts...)
+	log.Trace().Interface("config", cfg).Msg("Configuration loaded")
+
+	ignJson, err := cmd.generate(cfg)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to generate Ignition config")
 	}
@@ -73,3 +69,25 @@ func (cmd *GenerateCmd) Run() error {
 
 	return nil
 }
+
+// generate returns the Ignition config for cfg.
+func (cmd *GenerateCmd) generate(cfg *config.ApplianceConfig) ([]byte, error) {
+	opts := []ignition.GeneratorOpt{}
+	if cmd.BundledExtensions {
+		workdir, err := os.MkdirTemp("", "cola-generate")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+
+		defer os.RemoveAll(workdir)
+
+		err = fetchExtensionTransferConfigs(workdir, cmd.ExtensionDir, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch extension transfer configs: %w", err)
+		}
+
+		opts = append(opts, ignition.WithBundledExtensions(), ignition.WithExtensionDir(workdir))
+	}
+
+	return ignition.Generate(cfg, opts...)
+}
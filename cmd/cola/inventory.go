@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tmacro/cola/pkg/config"
+)
+
+// runInventory generates an Ignition config for each host of the inventory,
+// written to <output>/<host>.ign. Hosts are generated in parallel and share
+// the parsed config files.
+func (cmd *GenerateCmd) runInventory() error {
+	if cmd.Output == "" {
+		log.Fatal().Msg("No output directory specified")
+	}
+
+	hosts, err := config.ReadInventory(cmd.Inventory)
+	if err != nil {
+		fatalConfigError(err, "Failed to read inventory")
+	}
+
+	if err := os.MkdirAll(cmd.Output, 0o755); err != nil {
+		log.Fatal().Err(err).Msg("Failed to create output directory")
+	}
+
+	jobs := cmd.Jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+
+	// Diagnostics of different hosts are written one at a time.
+	var stderr sync.Mutex
+	files := config.NewFileCache()
+	var failed atomic.Int32
+	var wg sync.WaitGroup
+
+	queue := make(chan config.Host)
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range queue {
+				if !cmd.generateHost(host, files, &stderr) {
+					failed.Add(1)
+				}
+			}
+		}()
+	}
+
+	for _, host := range hosts {
+		queue <- host
+	}
+
+	close(queue)
+	wg.Wait()
+
+	if n := failed.Load(); n > 0 {
+		log.Fatal().Int("failed", int(n)).Int("hosts", len(hosts)).Msg("Failed to generate Ignition configs")
+	}
+
+	log.Info().Int("hosts", len(hosts)).Str("output", cmd.Output).Msg("Generated Ignition configs")
+
+	return nil
+}
+
+// generateHost generates and writes the Ignition config of a host, logging
+// any errors. It reports whether the config was written.
+func (cmd *GenerateCmd) generateHost(host config.Host, files *config.FileCache, stderr *sync.Mutex) bool {
+	logger := log.With().Str("host", host.Name).Logger()
+
+	valueFiles := append(slices.Clone(cmd.VarFile), host.ValueFiles...)
+	cfg, err := config.ReadConfig(cmd.Config, valueFiles,
+		config.WithVariables(cmd.Var),
+		config.WithEnviron(os.Environ()),
+		config.WithKeyFiles(cmd.KeyFile),
+		config.WithValues(host.Values),
+		config.WithFileCache(files),
+	)
+	if err != nil {
+		stderr.Lock()
+		defer stderr.Unlock()
+
+		if config.WriteDiagnostics(os.Stderr, err) {
+			logger.Error().Msg("Failed to read configuration")
+		} else {
+			logger.Error().Err(err).Msg("Failed to read configuration")
+		}
+
+		return false
+	}
+
+	diags := config.ValidateConfig(cfg)
+	if len(diags) > 0 {
+		stderr.Lock()
+		config.WriteDiagnostics(os.Stderr, diags)
+		stderr.Unlock()
+	}
+
+	if diags.HasErrors() {
+		logger.Error().Msg("Failed to validate configuration")
+		return false
+	}
+
+	ignJson, err := cmd.generate(cfg)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to generate Ignition config")
+		return false
+	}
+
+	path := filepath.Join(cmd.Output, host.Name+".ign")
+	if err := os.WriteFile(path, ignJson, 0o644); err != nil {
+		logger.Error().Err(err).Msg("Failed to write Ignition config")
+		return false
+	}
+
+	logger.Debug().Str("file", path).Msg("Wrote Ignition config")
+
+	return true
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/tmacro/cola/pkg/config"
+	"github.com/tmacro/cola/pkg/lsp"
+)
+
+type LspCmd struct {
+	Config  []string          `short:"c" help:"Path to the configuration file or directory. (default: directory of each document)" type:"path"`
+	VarFile []string          `short:"v" help:"Path to the files containing variable values." type:"path"`
+	Var     map[string]string `help:"Set a variable value. (name=value)" mapsep:"none"`
+	KeyFile []string          `help:"Path to an age identity file used to decrypt encrypted values." type:"path" env:"COLA_KEY_FILE"`
+}
+
+func (cmd *LspCmd) Run() error {
+	// Stdout carries the protocol, so logs go to stderr.
+	log.Logger = log.Logger.Output(zerolog.ConsoleWriter{Out: os.Stderr, NoColor: true})
+
+	server := lsp.NewServer(os.Stdin, os.Stdout,
+		lsp.WithConfig(cmd.Config),
+		lsp.WithValueFiles(cmd.VarFile),
+		lsp.WithReadOpts(config.WithVariables(cmd.Var), config.WithEnviron(os.Environ()), config.WithKeyFiles(cmd.KeyFile)),
+	)
+
+	if err := server.Run(); err != nil {
+		log.Fatal().Err(err).Msg("Language server failed")
+	}
+
+	return nil
+}
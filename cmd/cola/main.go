@@ -7,6 +7,7 @@ import (
 	"github.com/alecthomas/kong"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/tmacro/cola/pkg/config"
 )
 
 var CLI struct {
@@ -14,6 +15,9 @@ var CLI struct {
 	LogFormat string      `enum:"json,text" default:"text" help:"Set the log format. (json, text)"`
 	Generate  GenerateCmd `help:"Generate an Ignition config." cmd:""`
 	Bundle    BundleCmd   `help:"Bundle sysexts and an Ignition config with a Flatcar Linux image." cmd:""`
+	Fmt       FmtCmd      `help:"Rewrite config and value files in canonical format." cmd:""`
+	Schema    SchemaCmd   `help:"Export the schema of config files." cmd:""`
+	Lsp       LspCmd      `help:"Run a language server for config files over stdio." cmd:""`
 }
 
 func main() {
@@ -56,3 +60,13 @@ func main() {
 	err := cmd.Run()
 	cmd.FatalIfErrorf(err)
 }
+
+// fatalConfigError logs an error reading or validating the configuration and
+// exits. HCL diagnostics are written to stderr along with the source lines.
+func fatalConfigError(err error, msg string) {
+	if config.WriteDiagnostics(os.Stderr, err) {
+		log.Fatal().Msg(msg)
+	}
+
+	log.Fatal().Err(err).Msg(msg)
+}
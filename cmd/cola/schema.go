@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tmacro/cola/pkg/config"
+)
+
+type SchemaCmd struct {
+	Format string `short:"f" help:"Schema format. (json-schema, hcldec)" enum:"json-schema,hcldec" default:"json-schema"`
+	Output string `short:"o" help:"Output file."`
+}
+
+func (cmd *SchemaCmd) Run() error {
+	var schema []byte
+	switch cmd.Format {
+	case "json-schema":
+		var err error
+		schema, err = config.JSONSchema()
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to generate JSON Schema")
+		}
+	case "hcldec":
+		schema = config.HCLDecSpec()
+	}
+
+	var output io.Writer
+	if cmd.Output != "" {
+		file, err := os.Create(cmd.Output)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to open output file")
+		}
+
+		defer file.Close()
+		output = file
+	} else {
+		output = os.Stdout
+	}
+
+	_, err := output.Write(schema)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to write schema")
+	}
+
+	return nil
+}
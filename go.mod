@@ -3,6 +3,7 @@ module github.com/tmacro/cola
 go 1.23.4
 
 require (
+	filippo.io/age v1.2.0
 	github.com/alecthomas/kong v0.9.0
 	github.com/coreos/ignition/v2 v2.19.0
 	github.com/hashicorp/hcl/v2 v2.21.0
@@ -10,6 +11,7 @@ require (
 	github.com/rs/zerolog v1.33.0
 	github.com/vincent-petithory/dataurl v1.0.0
 	github.com/zclconf/go-cty v1.13.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -25,8 +27,10 @@ require (
 	github.com/mattn/go-isatty v0.0.19 // indirect
 	github.com/mitchellh/go-wordwrap v0.0.0-20150314170334-ad45545899c7 // indirect
 	github.com/moby/sys/mountinfo v0.7.2 // indirect
-	golang.org/x/mod v0.8.0 // indirect
-	golang.org/x/sys v0.20.0 // indirect
-	golang.org/x/text v0.15.0 // indirect
-	golang.org/x/tools v0.6.0 // indirect
+	golang.org/x/crypto v0.24.0 // indirect
+	golang.org/x/mod v0.18.0 // indirect
+	golang.org/x/sync v0.7.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	golang.org/x/tools v0.22.0 // indirect
 )
@@ -1,6 +1,7 @@
 package templates
 
 import (
+	"path/filepath"
 	"strings"
 	"text/template"
 
@@ -30,6 +31,22 @@ var systemdMountTpl = template.Must(
 	template.New("mount").
 		Parse(mustGetEmbeddedFile("systemd.mount.tpl")))
 
+var systemdAutomountTpl = template.Must(
+	template.New("automount").
+		Parse(mustGetEmbeddedFile("systemd.automount.tpl")))
+
+var systemdSwapTpl = template.Must(
+	template.New("swap").
+		Parse(mustGetEmbeddedFile("systemd.swap.tpl")))
+
+var swapfileServiceTpl = template.Must(
+	template.New("swapfileService").
+		Parse(mustGetEmbeddedFile("swapfile.service.tpl")))
+
+var zramGeneratorConfigTpl = template.Must(
+	template.New("zramGeneratorConfig").
+		Parse(mustGetEmbeddedFile("zram-generator.conf.tpl")))
+
 var systemdNetworkTpl = template.Must(
 	template.New("network").
 		Parse(mustGetEmbeddedFile("systemd.network.tpl")))
@@ -46,12 +63,66 @@ var systemdTmpfileConfigTpl = template.Must(
 	template.New("tmpfileConfig").
 		Parse(mustGetEmbeddedFile("systemd.tmpfile.tpl")))
 
-func SystemdContainer(container config.Container) (string, error) {
-	return renderTemplate(systemdContainerTpl, container)
+type containerConfig struct {
+	config.Container
+	RequiresMountsFor []string
+}
+
+// SystemdContainer renders the quadlet of a container. The container unit
+// requires the mounts of the paths in requiresMountsFor.
+func SystemdContainer(container config.Container, requiresMountsFor ...string) (string, error) {
+	return renderTemplate(systemdContainerTpl, containerConfig{Container: container, RequiresMountsFor: requiresMountsFor})
+}
+
+type mountConfig struct {
+	config.Mount
+	// Network is set for mounts of network file systems, which must wait
+	// for the network to be online.
+	Network bool
+	// Target is the target wanting the mount, or its automount.
+	Target string
+}
+
+func newMountConfig(mount config.Mount, network bool) mountConfig {
+	target := "local-fs.target"
+	if network {
+		target = "remote-fs.target"
+	}
+
+	return mountConfig{Mount: mount, Network: network, Target: target}
+}
+
+func SystemdMount(mount config.Mount, network bool) (string, error) {
+	return renderTemplate(systemdMountTpl, newMountConfig(mount, network))
+}
+
+func SystemdAutomount(mount config.Mount, network bool) (string, error) {
+	return renderTemplate(systemdAutomountTpl, newMountConfig(mount, network))
+}
+
+type swapConfig struct {
+	What     string
+	Priority int
+	// Service is the unit that sets up What before swap is enabled on it.
+	Service string
+}
+
+func SystemdSwap(what string, priority int, service string) (string, error) {
+	return renderTemplate(systemdSwapTpl, swapConfig{What: what, Priority: priority, Service: service})
+}
+
+type swapfileConfig struct {
+	Path    string
+	Dir     string
+	SizeMiB int
+}
+
+func SwapfileService(path string, sizeMiB int) (string, error) {
+	return renderTemplate(swapfileServiceTpl, swapfileConfig{Path: path, Dir: filepath.Dir(path), SizeMiB: sizeMiB})
 }
 
-func SystemdMount(mount config.Mount) (string, error) {
-	return renderTemplate(systemdMountTpl, mount)
+func ZramGeneratorConfig(swap config.Swap) (string, error) {
+	return renderTemplate(zramGeneratorConfigTpl, swap)
 }
 
 type networkConfig struct {
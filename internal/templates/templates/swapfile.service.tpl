@@ -0,0 +1,12 @@
+[Unit]
+Description=Create swap file {{ .Path }}
+RequiresMountsFor={{ .Dir }}
+ConditionPathExists=!{{ .Path }}
+
+[Service]
+Type=oneshot
+RemainAfterExit=true
+ExecStart=/usr/bin/mkdir -p {{ .Dir }}
+ExecStart=/usr/bin/fallocate -l {{ .SizeMiB }}MiB {{ .Path }}
+ExecStart=/usr/bin/chmod 600 {{ .Path }}
+ExecStart=/usr/sbin/mkswap {{ .Path }}
@@ -0,0 +1,8 @@
+[Unit]
+Description=Automount {{.Where}}
+
+[Automount]
+Where={{ .Where }}
+
+[Install]
+WantedBy={{ .Target }}
@@ -2,6 +2,9 @@
 Description={{.Name}}
 After=local-fs.target
 After=network-online.target
+{{- range .RequiresMountsFor }}
+RequiresMountsFor={{.}}
+{{- end }}
 
 [Container]
 Image={{.Image}}
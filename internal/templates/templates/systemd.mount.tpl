@@ -1,12 +1,17 @@
 [Unit]
 Description=Mount {{.Where}}
-After=network.target
-
+{{ if .Network -}}
+Requires=network-online.target
+After=network-online.target
+{{ end }}
 [Mount]
 What={{ .What }}
 Where={{ .Where }}
 Type={{ .Type }}
+{{ if .Options -}}
 Options={{ .Options }}
-
+{{ end -}}
+{{ if not .Automount }}
 [Install]
-WantedBy=multi-user.target
+WantedBy={{ .Target }}
+{{ end -}}
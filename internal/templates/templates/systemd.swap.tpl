@@ -0,0 +1,13 @@
+[Unit]
+Description=Swap on {{ .What }}
+{{ if .Service -}}
+Requires={{ .Service }}
+After={{ .Service }}
+{{ end }}
+[Swap]
+What={{ .What }}
+{{ if .Priority -}}
+Priority={{ .Priority }}
+{{ end }}
+[Install]
+WantedBy=swap.target
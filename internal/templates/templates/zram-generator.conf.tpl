@@ -0,0 +1,8 @@
+[zram0]
+zram-size = ram * {{ .RAMFraction }}
+{{ if .CompressionAlgorithm -}}
+compression-algorithm = {{ .CompressionAlgorithm }}
+{{ end -}}
+{{ if .Priority -}}
+swap-priority = {{ .Priority }}
+{{ end -}}
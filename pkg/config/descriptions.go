@@ -0,0 +1,179 @@
+package config
+
+// blockDescriptions documents the block types of the config, keyed by the
+// path of block types leading to the block. They are shown by the language
+// server and included in the JSON Schema.
+var blockDescriptions = map[string]string{
+	"system":              "Configures system-wide settings.",
+	"system.updates":      "Configures Flatcar OS update settings.",
+	"system.timesyncd":    "Configures the NTP servers used by systemd-timesyncd.",
+	"system.swap":         "Configures swap on a file, a partition or compressed RAM.",
+	"etcd":                "Configures the integrated etcd service.",
+	"etcd.peer":           "Configures an etcd cluster peer.",
+	"user":                "Configures a user account.",
+	"extension":           "Configures a systemd sysext extension.",
+	"container":           "Configures a container.",
+	"container.volume":    "Configures a container volume.",
+	"file":                "Manages the creation or modification of a file.",
+	"directory":           "Manages a directory on the system.",
+	"symlink":             "Creates a symbolic link.",
+	"mount":               "Configures a file system mount.",
+	"disk":                "Partitions a disk.",
+	"disk.partition":      "Defines a partition of a disk.",
+	"raid":                "Creates a software RAID array.",
+	"luks":                "Creates a LUKS encrypted volume.",
+	"luks.clevis":         "Binds a LUKS volume to clevis pins, which unlock it at boot.",
+	"luks.clevis.tang":    "Binds a LUKS volume to a tang server.",
+	"filesystem":          "Creates a file system on a device.",
+	"interface":           "Configures a network interface.",
+	"interface.vlan":      "Defines a VLAN on top of an interface.",
+	"service":             "Configures a systemd service.",
+	"service.drop_in":     "Defines a systemd drop-in file for a service.",
+	"variable":            "Defines a variable that can be referenced in other blocks as var.<name>.",
+	"variable.validation": "Checks the value of a variable once it has been resolved.",
+	"locals":              "Defines named values computed from variables and other locals.",
+	"module":              "Includes a reusable directory of configuration files.",
+}
+
+// attributeDescriptions documents the attributes of the config, keyed like
+// attributeEnums.
+var attributeDescriptions = map[string]string{
+	"system.hostname":                   "The hostname of the machine.",
+	"system.timezone":                   "The timezone of the machine, as named in the tz database (e.g., \"UTC\", \"America/New_York\").",
+	"system.enable_tty_auto_login":      "Enable automatic login on the console.",
+	"system.power_profile":              "The power profile to use.",
+	"system.updates.reboot_strategy":    "The reboot strategy for updates.",
+	"system.timesyncd.servers":          "The NTP servers to synchronize with.",
+	"system.timesyncd.fallback_servers": "The NTP servers used when no other server is known.",
+	"system.swap.type":                  "The kind of swap.",
+	"system.swap.path":                  "The path of the swap file. Defaults to /var/swapfile.",
+	"system.swap.size_mib":              "The size of the swap file in MiB.",
+	"system.swap.device":                "The partition to swap to.",
+	"system.swap.priority":              "The priority of the swap area.",
+	"system.swap.ram_fraction":          "The size of the zram device as a fraction of the RAM. Defaults to 0.5.",
+	"system.swap.compression_algorithm": "The compression algorithm of the zram device.",
+
+	"etcd.name":           "The name of the etcd member.",
+	"etcd.server":         "Whether this member is a server.",
+	"etcd.gateway":        "Whether this member is a gateway.",
+	"etcd.listen_address": "The listen address for the etcd member.",
+	"etcd.initial_token":  "The initial cluster token.",
+	"etcd.peer.address":   "The peer address.",
+	"etcd.peer.port":      "The peer port.",
+
+	"user.uid":                 "The user ID.",
+	"user.groups":              "The groups the user belongs to.",
+	"user.shell":               "The user's shell.",
+	"user.home_dir":            "The user's home directory.",
+	"user.no_create_home":      "Do not create the user's home directory.",
+	"user.ssh_authorized_keys": "The user's SSH authorized keys.",
+
+	"extension.version":    "The version of the extension.",
+	"extension.arch":       "The architecture of the extension (e.g., \"x86_64\", \"arm64\").",
+	"extension.bakery_url": "The URL of the extension's bakery.",
+
+	"container.image":         "The container image.",
+	"container.args":          "The arguments to pass to the container.",
+	"container.restart":       "The container restart policy.",
+	"container.cap_add":       "Additional Linux capabilities to add to the container.",
+	"container.volume.source": "The path on the host that is mounted into the container.",
+
+	"file.owner":       "The file owner.",
+	"file.group":       "The file group.",
+	"file.mode":        "The file permissions.",
+	"file.inline":      "The file contents provided inline.",
+	"file.source_path": "Path to a local file whose contents should be used.",
+	"file.url":         "Remote URL whose contents should be fetched and used.",
+	"file.overwrite":   "Overwrite the file if it already exists.",
+
+	"directory.owner": "The directory owner.",
+	"directory.group": "The directory group.",
+	"directory.mode":  "The directory permissions.",
+
+	"symlink.target":    "The file or directory the symlink should point to.",
+	"symlink.owner":     "The symlink owner.",
+	"symlink.group":     "The symlink group.",
+	"symlink.overwrite": "Overwrite the symlink if it already exists.",
+
+	"mount.type":      "The filesystem type (e.g., \"ext4\", \"nfs\", \"tmpfs\").",
+	"mount.what":      "The source device or remote path.",
+	"mount.where":     "Where to mount in the filesystem (mount target).",
+	"mount.options":   "Additional mount options (comma-separated).",
+	"mount.automount": "Mount the file system on first access, through an automount unit.",
+
+	"disk.wipe_table":                     "Wipe the partition table of the disk before partitioning it.",
+	"disk.partition.number":               "The partition number. 0 uses the next available number.",
+	"disk.partition.size_mib":             "The size of the partition in MiB. 0 uses the largest available size.",
+	"disk.partition.start_mib":            "The start of the partition in MiB. 0 uses the earliest available start.",
+	"disk.partition.type_guid":            "The GPT partition type GUID.",
+	"disk.partition.guid":                 "The GPT unique partition GUID.",
+	"disk.partition.wipe_partition_entry": "Replace an existing partition that does not match instead of failing.",
+	"disk.partition.resize":               "Resize an existing partition that does not match in size instead of failing.",
+
+	"raid.level":   "The RAID level.",
+	"raid.devices": "The devices of the array.",
+	"raid.spares":  "The number of spare devices in the array.",
+	"raid.options": "Additional options passed to mdadm.",
+
+	"luks.device":                    "The device to encrypt.",
+	"luks.label":                     "The label of the LUKS volume.",
+	"luks.uuid":                      "The UUID of the LUKS volume.",
+	"luks.key":                       "The key of the volume. Use a sensitive or encrypted variable.",
+	"luks.key_file_url":              "The URL the key of the volume is fetched from.",
+	"luks.wipe_volume":               "Wipe an existing volume that does not match instead of failing.",
+	"luks.discard":                   "Allow discard requests to pass through the volume.",
+	"luks.options":                   "Additional options passed to cryptsetup luksFormat.",
+	"luks.open_options":              "Additional options passed to cryptsetup luksOpen.",
+	"luks.clevis.tpm2":               "Bind the volume to the TPM2 of the machine.",
+	"luks.clevis.threshold":          "The number of pins that must unlock the volume.",
+	"luks.clevis.tang.thumbprint":    "The thumbprint of a trusted signing key of the tang server.",
+	"luks.clevis.tang.advertisement": "The advertisement of the tang server, to bind without contacting it.",
+
+	"filesystem.format":          "The file system type to create.",
+	"filesystem.label":           "The file system label.",
+	"filesystem.uuid":            "The file system UUID.",
+	"filesystem.path":            "Where Ignition mounts the file system while provisioning, e.g. to write files onto it.",
+	"filesystem.wipe_filesystem": "Wipe an existing file system that does not match instead of failing.",
+	"filesystem.options":         "Additional options passed to mkfs.",
+	"filesystem.mount_options":   "Options used when Ignition mounts the file system while provisioning.",
+
+	"interface.name":         "The interface name (e.g., \"eth0\").",
+	"interface.mac_address":  "The desired MAC address for the interface.",
+	"interface.gateway":      "The default gateway.",
+	"interface.address":      "The IPv4 or IPv6 address with CIDR (e.g., \"192.168.1.10/24\").",
+	"interface.addresses":    "A list of IPv4 or IPv6 addresses with CIDR. Mutually exclusive with address.",
+	"interface.dns":          "DNS nameserver address (e.g., \"8.8.8.8\").",
+	"interface.dhcp":         "Whether to enable DHCP on this interface.",
+	"interface.vlan.id":      "The VLAN ID number.",
+	"interface.vlan.address": "The VLAN's address with CIDR notation.",
+	"interface.vlan.gateway": "The VLAN's default gateway.",
+	"interface.vlan.dns":     "The VLAN's DNS server.",
+	"interface.vlan.dhcp":    "Whether to enable DHCP on this VLAN.",
+
+	"service.inline":              "The full systemd unit file content provided inline.",
+	"service.source_path":         "A path to a local file containing the systemd unit file.",
+	"service.enabled":             "Whether to enable (and start) the service.",
+	"service.drop_in.inline":      "The contents of the drop-in file provided inline.",
+	"service.drop_in.source_path": "A path to a local file containing the drop-in configuration.",
+
+	"variable.type":                     "The type of the variable (e.g., string, list(string), object({...})).",
+	"variable.default":                  "The value used when no value is supplied. Must be compatible with type.",
+	"variable.sensitive":                "Redact the value from log and trace output.",
+	"variable.validation.condition":     "An expression that must evaluate to true for the value to be accepted.",
+	"variable.validation.error_message": "The message reported when the condition is false.",
+
+	"module.source": "Path to the module directory, relative to the file containing the module block.",
+}
+
+// metaDescriptions documents the meta-arguments, which are shared by all
+// block types that accept them.
+var metaDescriptions = map[string]string{
+	"for_each": "Creates an instance of the block for each element of a map, set or list, available as each.key and each.value.",
+	"count":    "Creates the given number of instances of the block, available as count.index.",
+	"enabled":  "Includes the block only when true.",
+	"include":  "Includes the service block only when true. Service blocks use enabled to enable the systemd unit.",
+}
+
+// labelDescription documents the attributes setting the label of instances
+// created by for_each or count.
+const labelDescription = "Sets the block label, which must be unique across instances created by for_each or count."
@@ -1,5 +1,13 @@
 package config
 
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
 type ParseError struct {
 	Err  error
 	Path string
@@ -8,3 +16,71 @@ type ParseError struct {
 func (e ParseError) Error() string {
 	return e.Path + ": " + e.Err.Error()
 }
+
+func (e ParseError) Unwrap() error {
+	return e.Err
+}
+
+// sensitiveSubject marks diagnostics whose subject is the value of a
+// sensitive variable, e.g. in a value file.
+type sensitiveSubject struct{}
+
+// WriteDiagnostics writes the HCL diagnostics held by err to w, with a
+// snippet of the config source for each. It reports whether err held any
+// diagnostics. The values of the variables in an expression are left out, as
+// they may be sensitive, and so is the snippet of a sensitive value.
+func WriteDiagnostics(w io.Writer, err error) bool {
+	var diags hcl.Diagnostics
+	if !errors.As(err, &diags) {
+		return false
+	}
+
+	diags = withoutValues(diags)
+
+	files := make(map[string]*hcl.File)
+	for _, diag := range diags {
+		if diag.Subject == nil {
+			continue
+		}
+
+		if _, ok := files[diag.Subject.Filename]; ok {
+			continue
+		}
+
+		src, err := os.ReadFile(diag.Subject.Filename)
+		if err != nil {
+			continue
+		}
+
+		files[diag.Subject.Filename] = &hcl.File{Bytes: src}
+	}
+
+	writer := hcl.NewDiagnosticTextWriter(w, files, 0, false)
+	withoutSnippet := hcl.NewDiagnosticTextWriter(w, nil, 0, false)
+	for _, diag := range diags {
+		wr := writer
+		if _, ok := diag.Extra.(sensitiveSubject); ok {
+			wr = withoutSnippet
+		}
+
+		if err := wr.WriteDiagnostic(diag); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// withoutValues returns copies of diags without the expression and evaluation
+// context, from which the text writer would print the values of variables.
+func withoutValues(diags hcl.Diagnostics) hcl.Diagnostics {
+	stripped := make(hcl.Diagnostics, len(diags))
+	for i, diag := range diags {
+		d := *diag
+		d.Expression = nil
+		d.EvalContext = nil
+		stripped[i] = &d
+	}
+
+	return stripped
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteDiagnosticsRedactsSensitiveValues(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "appliance.hcl")
+	src := `
+system {
+  hostname = "cola"
+}
+
+variable "token" {
+  type      = string
+  sensitive = true
+
+  validation {
+    condition     = var.token != "supersecret"
+    error_message = "The token ${var.token} is not allowed."
+  }
+}
+`
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	valuePath := filepath.Join(dir, "values.cvars")
+	if err := os.WriteFile(valuePath, []byte("token = \"supersecret\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ReadConfig([]string{path}, []string{valuePath})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	var out bytes.Buffer
+	if !WriteDiagnostics(&out, err) {
+		t.Fatalf("expected diagnostics, got %v", err)
+	}
+
+	if !strings.Contains(out.String(), "Invalid value for variable") {
+		t.Fatalf("expected a failed validation, got:\n%s", out.String())
+	}
+
+	if strings.Contains(out.String(), "supersecret") {
+		t.Errorf("diagnostics contain the sensitive value:\n%s", out.String())
+	}
+}
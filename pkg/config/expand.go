@@ -0,0 +1,633 @@
+package config
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// repeatableBlocks lists the top-level block types that accept the for_each
+// and count meta-arguments. The value is the name of the block label, which an
+// instance can set through an attribute of the same name, e.g.
+//
+//	user "admins" {
+//	  for_each = var.admins
+//	  username = each.key
+//	}
+var repeatableBlocks = map[string]string{
+	"user":      "username",
+	"file":      "path",
+	"directory": "path",
+	"container": "name",
+	"extension": "name",
+	"interface": "",
+	"service":   "name",
+}
+
+// unconditionalBlocks lists the block types that cannot be included
+// conditionally. Variables and locals are evaluated before any other block.
+var unconditionalBlocks = map[string]bool{
+	"variable": true,
+	"locals":   true,
+}
+
+// conditionAttributes lists the block types whose enabled meta-argument goes
+// by another name, as they have an attribute named enabled. Service blocks use
+// enabled to enable the systemd unit.
+var conditionAttributes = map[string]string{
+	"service": "include",
+}
+
+// conditionAttribute returns the name of the meta-argument that includes a
+// block conditionally, or "" if the block type has none.
+func conditionAttribute(blockType string) string {
+	if unconditionalBlocks[blockType] {
+		return ""
+	}
+
+	if name, ok := conditionAttributes[blockType]; ok {
+		return name
+	}
+
+	return "enabled"
+}
+
+// metaAttributes returns the meta-arguments accepted by a block type.
+func metaAttributes(blockType string, topLevel bool) []string {
+	attrs := make([]string, 0)
+	if _, ok := repeatableBlocks[blockType]; ok && topLevel {
+		attrs = append(attrs, "for_each", "count")
+	}
+
+	if name := conditionAttribute(blockType); name != "" {
+		attrs = append(attrs, name)
+	}
+
+	return attrs
+}
+
+func metaSchema(attrs []string) *hcl.BodySchema {
+	schema := &hcl.BodySchema{}
+	for _, name := range attrs {
+		schema.Attributes = append(schema.Attributes, hcl.AttributeSchema{Name: name})
+	}
+
+	return schema
+}
+
+// blockEnabled evaluates the enabled meta-argument of a block, or the one
+// taking its place. Blocks without the argument are enabled.
+func blockEnabled(attr *hcl.Attribute, evalCtx *hcl.EvalContext) (bool, hcl.Diagnostics) {
+	val, diags := attr.Expr.Value(evalCtx)
+	if diags.HasErrors() {
+		return false, diags
+	}
+
+	if val.IsNull() || !val.IsKnown() || val.Type() != cty.Bool {
+		return false, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s argument", attr.Name),
+			Detail:   fmt.Sprintf("The %q argument must be true or false.", attr.Name),
+			Subject:  attr.Expr.Range().Ptr(),
+		}}
+	}
+
+	return val.True(), nil
+}
+
+// expandBody wraps the body of a config file. It expands repeatable blocks
+// with for_each or count into one block per instance, and drops blocks whose
+// enabled meta-argument is false. The source of each block is recorded in
+// sources for merging, along with the attributes for which sensitive reports
+// that they are set from sensitive values. Blocks of override files do not
+// require any attribute, as they only change existing blocks.
+type expandBody struct {
+	original  hcl.Body
+	evalCtx   *hcl.EvalContext
+	sources   sourceMap
+	sensitive func(hcl.Expression) bool
+	override  bool
+	indexes   map[string]int
+}
+
+func newExpandBody(body hcl.Body, evalCtx *hcl.EvalContext, sources sourceMap, sensitive func(hcl.Expression) bool, override bool) hcl.Body {
+	return &expandBody{
+		original:  body,
+		evalCtx:   evalCtx,
+		sources:   sources,
+		sensitive: sensitive,
+		override:  override,
+		indexes:   make(map[string]int),
+	}
+}
+
+func (b *expandBody) Content(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	content, diags := b.original.Content(schema)
+	if content == nil {
+		return content, diags
+	}
+
+	blocks, blockDiags := b.expandBlocks(content.Blocks)
+	diags = append(diags, blockDiags...)
+	content.Blocks = blocks
+
+	return content, diags
+}
+
+func (b *expandBody) PartialContent(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Body, hcl.Diagnostics) {
+	content, remain, diags := b.original.PartialContent(schema)
+	if content == nil {
+		return content, remain, diags
+	}
+
+	blocks, blockDiags := b.expandBlocks(content.Blocks)
+	diags = append(diags, blockDiags...)
+	content.Blocks = blocks
+
+	return content, newExpandBody(remain, b.evalCtx, b.sources, b.sensitive, b.override), diags
+}
+
+func (b *expandBody) JustAttributes() (hcl.Attributes, hcl.Diagnostics) {
+	return b.original.JustAttributes()
+}
+
+func (b *expandBody) MissingItemRange() hcl.Range {
+	return b.original.MissingItemRange()
+}
+
+func (b *expandBody) expandBlocks(blocks hcl.Blocks) (hcl.Blocks, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	expanded := make(hcl.Blocks, 0, len(blocks))
+
+	for _, block := range blocks {
+		if block.Type == "variable" || block.Type == "locals" {
+			expanded = append(expanded, block)
+			continue
+		}
+
+		instances, instDiags := b.expandBlock(block)
+		diags = append(diags, instDiags...)
+		expanded = append(expanded, instances...)
+	}
+
+	return expanded, diags
+}
+
+// expandBlock evaluates the meta-arguments of a block and returns a copy of
+// the block for each enabled instance.
+func (b *expandBody) expandBlock(block *hcl.Block) (hcl.Blocks, hcl.Diagnostics) {
+	metaAttrs := metaAttributes(block.Type, true)
+	meta, _, diags := block.Body.PartialContent(metaSchema(metaAttrs))
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	forEach, hasForEach := meta.Attributes["for_each"]
+	count, hasCount := meta.Attributes["count"]
+
+	if hasForEach && hasCount {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid combination of \"count\" and \"for_each\"",
+			Detail:   "The \"count\" and \"for_each\" meta-arguments are mutually-exclusive, only one should be used.",
+			Subject:  count.NameRange.Ptr(),
+		}}
+	}
+
+	var iterations []*iteration
+	switch {
+	case hasForEach:
+		iterations, diags = b.forEachIterations(block, forEach)
+	case hasCount:
+		iterations, diags = b.countIterations(block, count)
+	default:
+		iterations = []*iteration{nil}
+	}
+
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	labelAttr := repeatableBlocks[block.Type]
+	if !hasForEach && !hasCount {
+		labelAttr = ""
+	}
+
+	if labelAttr != "" {
+		metaAttrs = append(metaAttrs, labelAttr)
+	}
+
+	instances := make(hcl.Blocks, 0, len(iterations))
+	for _, iter := range iterations {
+		evalCtx := b.evalCtx
+		if iter != nil {
+			evalCtx = iter.evalCtx(b.evalCtx)
+		}
+
+		if enabled, ok := meta.Attributes[conditionAttribute(block.Type)]; ok {
+			isEnabled, enabledDiags := blockEnabled(enabled, evalCtx)
+			if enabledDiags.HasErrors() {
+				diags = append(diags, iter.annotate(enabledDiags)...)
+				continue
+			}
+
+			if !isEnabled {
+				continue
+			}
+		}
+
+		instance := *block
+		body := &instanceBody{
+			original:  block.Body,
+			iteration: iter,
+			evalCtx:   b.evalCtx,
+			metaAttrs: metaAttrs,
+			sources:   b.sources,
+			sensitive: b.sensitive,
+			override:  b.override,
+			optional:  b.override,
+		}
+		instance.Body = body
+
+		if labelAttr != "" && len(block.Labels) > 0 {
+			label, labelDiags := iter.label(block, labelAttr, b.evalCtx)
+			diags = append(diags, labelDiags...)
+			if labelDiags.HasErrors() {
+				continue
+			}
+
+			if label != "" {
+				instance.Labels = append([]string{label}, block.Labels[1:]...)
+			}
+		}
+
+		// Unlabeled repeatable blocks, such as interfaces, are recorded by
+		// their index in the file. They are not merged by address.
+		body.defRange = block.DefRange
+		if _, ok := repeatableBlocks[block.Type]; ok && len(instance.Labels) == 0 {
+			body.address = fmt.Sprintf("%s[%d]", block.Type, b.indexes[block.Type])
+			b.indexes[block.Type]++
+		} else {
+			body.address = blockAddress(&instance)
+		}
+
+		instances = append(instances, &instance)
+	}
+
+	return instances, diags
+}
+
+func (b *expandBody) forEachIterations(block *hcl.Block, attr *hcl.Attribute) ([]*iteration, hcl.Diagnostics) {
+	val, diags := attr.Expr.Value(b.evalCtx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	invalid := func(detail string) hcl.Diagnostics {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid for_each argument",
+			Detail:   detail,
+			Subject:  attr.Expr.Range().Ptr(),
+		}}
+	}
+
+	if val.IsNull() {
+		return nil, invalid("The given \"for_each\" argument value is null. A map, set or list is required.")
+	}
+
+	if !val.IsWhollyKnown() {
+		return nil, invalid("The \"for_each\" value depends on values that cannot be determined.")
+	}
+
+	ty := val.Type()
+	if !ty.IsMapType() && !ty.IsObjectType() && !ty.IsListType() && !ty.IsTupleType() && !ty.IsSetType() {
+		return nil, invalid(fmt.Sprintf("The \"for_each\" argument must be a map, set or list, not %s.", ty.FriendlyName()))
+	}
+
+	sensitive := b.sensitive != nil && b.sensitive(attr.Expr)
+
+	iterations := make([]*iteration, 0, val.LengthInt())
+	for it := val.ElementIterator(); it.Next(); {
+		key, value := it.Element()
+		if ty.IsSetType() {
+			key = value
+		}
+
+		iterations = append(iterations, &iteration{
+			name: fmt.Sprintf("%s[%s]", blockAddress(block), ctyValueToString(key)),
+			vars: map[string]cty.Value{
+				"each": cty.ObjectVal(map[string]cty.Value{
+					"key":   key,
+					"value": value,
+				}),
+			},
+			sensitive: sensitive,
+		})
+	}
+
+	return iterations, nil
+}
+
+func (b *expandBody) countIterations(block *hcl.Block, attr *hcl.Attribute) ([]*iteration, hcl.Diagnostics) {
+	val, diags := attr.Expr.Value(b.evalCtx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	invalid := func(detail string) hcl.Diagnostics {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid count argument",
+			Detail:   detail,
+			Subject:  attr.Expr.Range().Ptr(),
+		}}
+	}
+
+	if val.IsNull() || !val.IsKnown() || val.Type() != cty.Number {
+		return nil, invalid("The \"count\" argument must be a whole number.")
+	}
+
+	count, acc := val.AsBigFloat().Int64()
+	if acc != big.Exact || count < 0 {
+		return nil, invalid("The \"count\" argument must be a non-negative whole number.")
+	}
+
+	iterations := make([]*iteration, 0, count)
+	for i := int64(0); i < count; i++ {
+		iterations = append(iterations, &iteration{
+			name: fmt.Sprintf("%s[%d]", blockAddress(block), i),
+			vars: map[string]cty.Value{
+				"count": cty.ObjectVal(map[string]cty.Value{
+					"index": cty.NumberIntVal(i),
+				}),
+			},
+		})
+	}
+
+	return iterations, nil
+}
+
+func blockAddress(block *hcl.Block) string {
+	address := block.Type
+	for _, label := range block.Labels {
+		address += fmt.Sprintf(" %q", label)
+	}
+
+	return address
+}
+
+// iteration holds the each or count values of a single block instance.
+// The each values of a for_each over a sensitive value are sensitive.
+type iteration struct {
+	name      string
+	vars      map[string]cty.Value
+	sensitive bool
+}
+
+func (i *iteration) evalCtx(parent *hcl.EvalContext) *hcl.EvalContext {
+	if parent == nil {
+		parent = &hcl.EvalContext{}
+	}
+
+	ctx := parent.NewChild()
+	ctx.Variables = i.vars
+
+	return ctx
+}
+
+// label evaluates the attribute that overrides the block label of an
+// instance. An empty string is returned if the attribute is not set.
+func (i *iteration) label(block *hcl.Block, labelAttr string, evalCtx *hcl.EvalContext) (string, hcl.Diagnostics) {
+	content, _, diags := block.Body.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: labelAttr}},
+	})
+	if diags.HasErrors() {
+		return "", diags
+	}
+
+	attr, ok := content.Attributes[labelAttr]
+	if !ok {
+		return "", nil
+	}
+
+	val, diags := attr.Expr.Value(i.evalCtx(evalCtx))
+	if diags.HasErrors() {
+		return "", i.annotate(diags)
+	}
+
+	if val.IsNull() || !val.IsKnown() || val.Type() != cty.String {
+		return "", hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  fmt.Sprintf("Invalid %s", labelAttr),
+			Detail:   fmt.Sprintf("The %q attribute of %s must be a string.", labelAttr, i.name),
+			Subject:  attr.Expr.Range().Ptr(),
+		}}
+	}
+
+	return val.AsString(), nil
+}
+
+// annotate adds the instance name to diagnostics raised while decoding it.
+func (i *iteration) annotate(diags hcl.Diagnostics) hcl.Diagnostics {
+	if i == nil {
+		return diags
+	}
+
+	for _, diag := range diags {
+		diag.Detail = fmt.Sprintf("%s (in %s)", diag.Detail, i.name)
+	}
+
+	return diags
+}
+
+// instanceBody wraps the body of a single instance of a block. It hides the
+// meta-arguments from the decoder, evaluates all expressions with the each or
+// count values of the instance, and drops nested blocks that are not enabled.
+// Blocks with an address record their source when their content is read.
+type instanceBody struct {
+	original  hcl.Body
+	iteration *iteration
+	evalCtx   *hcl.EvalContext
+	metaAttrs []string
+
+	address   string
+	defRange  hcl.Range
+	sources   sourceMap
+	sensitive func(hcl.Expression) bool
+	override  bool
+	optional  bool
+	recorded  bool
+}
+
+func (b *instanceBody) extendSchema(schema *hcl.BodySchema) *hcl.BodySchema {
+	if len(b.metaAttrs) == 0 && !b.optional {
+		return schema
+	}
+
+	attrs := append(slices.Clone(schema.Attributes), metaSchema(b.metaAttrs).Attributes...)
+	if b.optional {
+		for i := range attrs {
+			attrs[i].Required = false
+		}
+	}
+
+	return &hcl.BodySchema{
+		Attributes: attrs,
+		Blocks:     schema.Blocks,
+	}
+}
+
+func (b *instanceBody) record(attrs hcl.Attributes) hcl.Diagnostics {
+	if b.sources == nil || b.address == "" || b.recorded {
+		return nil
+	}
+
+	b.recorded = true
+	return b.iteration.annotate(b.sources.record(b.address, b.defRange, attrs, b.sensitiveExpr, b.override))
+}
+
+// sensitiveExpr reports whether an attribute of the instance is set from a
+// sensitive value, directly or through the each values of its iteration.
+func (b *instanceBody) sensitiveExpr(expr hcl.Expression) bool {
+	if b.sensitive == nil {
+		return false
+	}
+
+	if b.sensitive(expr) {
+		return true
+	}
+
+	if b.iteration == nil || !b.iteration.sensitive {
+		return false
+	}
+
+	for _, traversal := range expr.Variables() {
+		if traversal.RootName() == "each" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b *instanceBody) prepareContent(content *hcl.BodyContent) (*hcl.BodyContent, hcl.Diagnostics) {
+	if content == nil {
+		return nil, nil
+	}
+
+	var diags hcl.Diagnostics
+
+	attrs := make(hcl.Attributes, len(content.Attributes))
+	for name, attr := range content.Attributes {
+		if slices.Contains(b.metaAttrs, name) {
+			continue
+		}
+
+		attrs[name] = b.wrapAttr(attr)
+	}
+
+	diags = append(diags, b.record(attrs)...)
+
+	evalCtx := b.evalCtx
+	if b.iteration != nil {
+		evalCtx = b.iteration.evalCtx(b.evalCtx)
+	}
+
+	blocks := make(hcl.Blocks, 0, len(content.Blocks))
+	for _, block := range content.Blocks {
+		metaAttrs := metaAttributes(block.Type, false)
+		meta, _, metaDiags := block.Body.PartialContent(metaSchema(metaAttrs))
+		diags = append(diags, metaDiags...)
+
+		if enabled, ok := meta.Attributes[conditionAttribute(block.Type)]; ok {
+			isEnabled, enabledDiags := blockEnabled(enabled, evalCtx)
+			diags = append(diags, b.iteration.annotate(enabledDiags)...)
+			if enabledDiags.HasErrors() || !isEnabled {
+				continue
+			}
+		}
+
+		body := &instanceBody{
+			original:  block.Body,
+			iteration: b.iteration,
+			evalCtx:   b.evalCtx,
+			metaAttrs: metaAttrs,
+			sources:   b.sources,
+			sensitive: b.sensitive,
+			override:  b.override,
+		}
+
+		if b.address != "" {
+			body.address = nestedAddress(b.address, blockAddress(block))
+			body.defRange = block.DefRange
+		}
+
+		nested := *block
+		nested.Body = body
+		blocks = append(blocks, &nested)
+	}
+
+	return &hcl.BodyContent{
+		Attributes:       attrs,
+		Blocks:           blocks,
+		MissingItemRange: content.MissingItemRange,
+	}, diags
+}
+
+func (b *instanceBody) wrapAttr(attr *hcl.Attribute) *hcl.Attribute {
+	if b.iteration == nil {
+		return attr
+	}
+
+	wrapped := *attr
+	wrapped.Expr = &instanceExpr{Expression: attr.Expr, iteration: b.iteration}
+
+	return &wrapped
+}
+
+func (b *instanceBody) Content(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	content, diags := b.original.Content(b.extendSchema(schema))
+	prepared, prepDiags := b.prepareContent(content)
+	return prepared, append(diags, prepDiags...)
+}
+
+func (b *instanceBody) PartialContent(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Body, hcl.Diagnostics) {
+	content, remain, diags := b.original.PartialContent(b.extendSchema(schema))
+	prepared, prepDiags := b.prepareContent(content)
+	return prepared, &instanceBody{original: remain, iteration: b.iteration, evalCtx: b.evalCtx}, append(diags, prepDiags...)
+}
+
+func (b *instanceBody) JustAttributes() (hcl.Attributes, hcl.Diagnostics) {
+	attrs, diags := b.original.JustAttributes()
+
+	wrapped := make(hcl.Attributes, len(attrs))
+	for name, attr := range attrs {
+		if slices.Contains(b.metaAttrs, name) {
+			continue
+		}
+
+		wrapped[name] = b.wrapAttr(attr)
+	}
+
+	return wrapped, diags
+}
+
+func (b *instanceBody) MissingItemRange() hcl.Range {
+	return b.original.MissingItemRange()
+}
+
+// instanceExpr evaluates an expression with the each or count values of a
+// block instance added to the evaluation context.
+type instanceExpr struct {
+	hcl.Expression
+	iteration *iteration
+}
+
+func (e *instanceExpr) Value(ctx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	val, diags := e.Expression.Value(e.iteration.evalCtx(ctx))
+	return val, e.iteration.annotate(diags)
+}
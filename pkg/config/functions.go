@@ -0,0 +1,460 @@
+package config
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/tryfunc"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+// buildFunctions returns the functions available to expressions in config
+// files. Filesystem functions resolve relative paths against baseDir, which
+// is the directory of the file being evaluated.
+func buildFunctions(baseDir string) map[string]function.Function {
+	funcs := map[string]function.Function{
+		"abs":             stdlib.AbsoluteFunc,
+		"can":             tryfunc.CanFunc,
+		"ceil":            stdlib.CeilFunc,
+		"chomp":           stdlib.ChompFunc,
+		"chunklist":       stdlib.ChunklistFunc,
+		"coalesce":        stdlib.CoalesceFunc,
+		"coalescelist":    stdlib.CoalesceListFunc,
+		"compact":         stdlib.CompactFunc,
+		"concat":          stdlib.ConcatFunc,
+		"contains":        stdlib.ContainsFunc,
+		"csvdecode":       stdlib.CSVDecodeFunc,
+		"distinct":        stdlib.DistinctFunc,
+		"element":         stdlib.ElementFunc,
+		"flatten":         stdlib.FlattenFunc,
+		"floor":           stdlib.FloorFunc,
+		"format":          stdlib.FormatFunc,
+		"formatdate":      stdlib.FormatDateFunc,
+		"formatlist":      stdlib.FormatListFunc,
+		"indent":          stdlib.IndentFunc,
+		"index":           stdlib.IndexFunc,
+		"join":            stdlib.JoinFunc,
+		"jsondecode":      stdlib.JSONDecodeFunc,
+		"jsonencode":      stdlib.JSONEncodeFunc,
+		"keys":            stdlib.KeysFunc,
+		"length":          lengthFunc,
+		"log":             stdlib.LogFunc,
+		"lookup":          stdlib.LookupFunc,
+		"lower":           stdlib.LowerFunc,
+		"max":             stdlib.MaxFunc,
+		"merge":           stdlib.MergeFunc,
+		"min":             stdlib.MinFunc,
+		"parseint":        stdlib.ParseIntFunc,
+		"pow":             stdlib.PowFunc,
+		"range":           stdlib.RangeFunc,
+		"regex":           stdlib.RegexFunc,
+		"regexall":        stdlib.RegexAllFunc,
+		"regexreplace":    stdlib.RegexReplaceFunc,
+		"replace":         stdlib.ReplaceFunc,
+		"reverse":         stdlib.ReverseListFunc,
+		"setintersection": stdlib.SetIntersectionFunc,
+		"setproduct":      stdlib.SetProductFunc,
+		"setsubtract":     stdlib.SetSubtractFunc,
+		"setunion":        stdlib.SetUnionFunc,
+		"signum":          stdlib.SignumFunc,
+		"slice":           stdlib.SliceFunc,
+		"sort":            stdlib.SortFunc,
+		"split":           stdlib.SplitFunc,
+		"strlen":          stdlib.StrlenFunc,
+		"strrev":          stdlib.ReverseFunc,
+		"substr":          stdlib.SubstrFunc,
+		"timeadd":         stdlib.TimeAddFunc,
+		"title":           stdlib.TitleFunc,
+		"tobool":          stdlib.MakeToFunc(cty.Bool),
+		"tolist":          stdlib.MakeToFunc(cty.List(cty.DynamicPseudoType)),
+		"tomap":           stdlib.MakeToFunc(cty.Map(cty.DynamicPseudoType)),
+		"tonumber":        stdlib.MakeToFunc(cty.Number),
+		"toset":           stdlib.MakeToFunc(cty.Set(cty.DynamicPseudoType)),
+		"tostring":        stdlib.MakeToFunc(cty.String),
+		"trim":            stdlib.TrimFunc,
+		"trimprefix":      stdlib.TrimPrefixFunc,
+		"trimspace":       stdlib.TrimSpaceFunc,
+		"trimsuffix":      stdlib.TrimSuffixFunc,
+		"try":             tryfunc.TryFunc,
+		"upper":           stdlib.UpperFunc,
+		"values":          stdlib.ValuesFunc,
+		"zipmap":          stdlib.ZipmapFunc,
+
+		"base64decode": base64DecodeFunc,
+		"base64encode": base64EncodeFunc,
+		"md5":          makeHashFunc(md5.New),
+		"sha1":         makeHashFunc(sha1.New),
+		"sha256":       makeHashFunc(sha256.New),
+		"sha512":       makeHashFunc(sha512.New),
+
+		"cidrhost":    cidrHostFunc,
+		"cidrnetmask": cidrNetmaskFunc,
+		"cidrsubnet":  cidrSubnetFunc,
+
+		"basename":   basenameFunc,
+		"dirname":    dirnameFunc,
+		"file":       makeFileFunc(baseDir, false),
+		"filebase64": makeFileFunc(baseDir, true),
+		"fileexists": makeFileExistsFunc(baseDir),
+	}
+
+	// templatefile gets a copy of the other functions, so that templates
+	// cannot recursively render themselves.
+	templateFuncs := make(map[string]function.Function, len(funcs))
+	for name, fn := range funcs {
+		templateFuncs[name] = fn
+	}
+	funcs["templatefile"] = makeTemplateFileFunc(baseDir, templateFuncs)
+
+	return funcs
+}
+
+var base64EncodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "str", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.StringVal(base64.StdEncoding.EncodeToString([]byte(args[0].AsString()))), nil
+	},
+})
+
+var base64DecodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "str", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		decoded, err := base64.StdEncoding.DecodeString(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), fmt.Errorf("failed to decode base64 data: %w", err)
+		}
+
+		if !utf8.Valid(decoded) {
+			return cty.UnknownVal(cty.String), fmt.Errorf("decoded base64 data is not valid UTF-8")
+		}
+
+		return cty.StringVal(string(decoded)), nil
+	},
+})
+
+// lengthFunc returns the number of characters of a string, or the number of
+// elements of any other collection, like the length function of Terraform.
+var lengthFunc = function.New(&function.Spec{
+	Params: []function.Parameter{{
+		Name:             "value",
+		Type:             cty.DynamicPseudoType,
+		AllowDynamicType: true,
+	}},
+	Type: function.StaticReturnType(cty.Number),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		if args[0].Type() == cty.String {
+			return stdlib.Strlen(args[0])
+		}
+
+		return stdlib.Length(args[0])
+	},
+})
+
+func makeHashFunc(newHash func() hash.Hash) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "str", Type: cty.String},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			h := newHash()
+			h.Write([]byte(args[0].AsString()))
+			return cty.StringVal(hex.EncodeToString(h.Sum(nil))), nil
+		},
+	})
+}
+
+// addrToInt converts an address to its integer representation.
+func addrToInt(addr netip.Addr) *big.Int {
+	return new(big.Int).SetBytes(addr.AsSlice())
+}
+
+// intToAddr converts an integer back into an address of the given bit length.
+func intToAddr(n *big.Int, bits int) (netip.Addr, error) {
+	if n.Sign() < 0 || n.BitLen() > bits {
+		return netip.Addr{}, fmt.Errorf("address is outside of the address space")
+	}
+
+	buf := make([]byte, bits/8)
+	n.FillBytes(buf)
+
+	addr, ok := netip.AddrFromSlice(buf)
+	if !ok {
+		return netip.Addr{}, fmt.Errorf("invalid address length")
+	}
+
+	return addr, nil
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid CIDR expression: %w", err)
+	}
+
+	return prefix.Masked(), nil
+}
+
+var cidrHostFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "prefix", Type: cty.String},
+		{Name: "hostnum", Type: cty.Number},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		prefix, err := parsePrefix(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+
+		hostnum, acc := args[1].AsBigFloat().Int(nil)
+		if acc != big.Exact {
+			return cty.UnknownVal(cty.String), fmt.Errorf("hostnum must be a whole number")
+		}
+
+		bits := prefix.Addr().BitLen()
+		hostBits := uint(bits - prefix.Bits())
+		size := new(big.Int).Lsh(big.NewInt(1), hostBits)
+
+		// Negative host numbers count backwards from the end of the range.
+		if hostnum.Sign() < 0 {
+			hostnum.Add(hostnum, size)
+		}
+
+		if hostnum.Sign() < 0 || hostnum.Cmp(size) >= 0 {
+			return cty.UnknownVal(cty.String), fmt.Errorf("prefix %s has no host number %s", prefix, args[1].AsBigFloat().String())
+		}
+
+		addr, err := intToAddr(new(big.Int).Add(addrToInt(prefix.Addr()), hostnum), bits)
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+
+		return cty.StringVal(addr.String()), nil
+	},
+})
+
+var cidrNetmaskFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "prefix", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		prefix, err := parsePrefix(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+
+		if !prefix.Addr().Is4() {
+			return cty.UnknownVal(cty.String), fmt.Errorf("netmasks are only supported for IPv4 prefixes")
+		}
+
+		mask := new(big.Int).Lsh(big.NewInt(1), uint(prefix.Bits()))
+		mask.Sub(mask, big.NewInt(1))
+		mask.Lsh(mask, uint(32-prefix.Bits()))
+
+		addr, err := intToAddr(mask, 32)
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+
+		return cty.StringVal(addr.String()), nil
+	},
+})
+
+var cidrSubnetFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "prefix", Type: cty.String},
+		{Name: "newbits", Type: cty.Number},
+		{Name: "netnum", Type: cty.Number},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		prefix, err := parsePrefix(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+
+		var newbits int
+		if err := gocty.FromCtyValue(args[1], &newbits); err != nil {
+			return cty.UnknownVal(cty.String), fmt.Errorf("invalid newbits: %w", err)
+		}
+
+		netnum, acc := args[2].AsBigFloat().Int(nil)
+		if acc != big.Exact || netnum.Sign() < 0 {
+			return cty.UnknownVal(cty.String), fmt.Errorf("netnum must be a non-negative whole number")
+		}
+
+		bits := prefix.Addr().BitLen()
+		newLen := prefix.Bits() + newbits
+		if newbits < 0 || newLen > bits {
+			return cty.UnknownVal(cty.String), fmt.Errorf("not enough remaining address space to extend prefix %s by %d bits", prefix, newbits)
+		}
+
+		if netnum.BitLen() > newbits {
+			return cty.UnknownVal(cty.String), fmt.Errorf("prefix extension of %d bits does not accommodate a subnet numbered %s", newbits, netnum)
+		}
+
+		offset := new(big.Int).Lsh(netnum, uint(bits-newLen))
+		addr, err := intToAddr(new(big.Int).Add(addrToInt(prefix.Addr()), offset), bits)
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+
+		return cty.StringVal(netip.PrefixFrom(addr, newLen).String()), nil
+	},
+})
+
+var basenameFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "path", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.StringVal(filepath.Base(args[0].AsString())), nil
+	},
+})
+
+var dirnameFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "path", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return cty.StringVal(filepath.Dir(args[0].AsString())), nil
+	},
+})
+
+func resolvePath(baseDir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(baseDir, path)
+}
+
+func makeFileFunc(baseDir string, encodeBase64 bool) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "path", Type: cty.String},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			path := resolvePath(baseDir, args[0].AsString())
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return cty.UnknownVal(cty.String), fmt.Errorf("failed to read file %s: %w", path, err)
+			}
+
+			if encodeBase64 {
+				return cty.StringVal(base64.StdEncoding.EncodeToString(content)), nil
+			}
+
+			if !utf8.Valid(content) {
+				return cty.UnknownVal(cty.String), fmt.Errorf("contents of %s are not valid UTF-8; use filebase64 instead", path)
+			}
+
+			return cty.StringVal(string(content)), nil
+		},
+	})
+}
+
+func makeFileExistsFunc(baseDir string) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "path", Type: cty.String},
+		},
+		Type: function.StaticReturnType(cty.Bool),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			path := resolvePath(baseDir, args[0].AsString())
+			fi, err := os.Stat(path)
+			if err != nil {
+				if os.IsNotExist(err) {
+					return cty.False, nil
+				}
+				return cty.UnknownVal(cty.Bool), fmt.Errorf("failed to stat %s: %w", path, err)
+			}
+
+			if !fi.Mode().IsRegular() {
+				return cty.UnknownVal(cty.Bool), fmt.Errorf("%s is not a regular file", path)
+			}
+
+			return cty.True, nil
+		},
+	})
+}
+
+func makeTemplateFileFunc(baseDir string, funcs map[string]function.Function) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{
+			{Name: "path", Type: cty.String},
+			{Name: "vars", Type: cty.DynamicPseudoType},
+		},
+		Type: function.StaticReturnType(cty.String),
+		Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+			path := resolvePath(baseDir, args[0].AsString())
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return cty.UnknownVal(cty.String), fmt.Errorf("failed to read template %s: %w", path, err)
+			}
+
+			vars := args[1]
+			if !vars.Type().IsObjectType() && !vars.Type().IsMapType() {
+				return cty.UnknownVal(cty.String), fmt.Errorf("template variables must be an object or map")
+			}
+
+			expr, diags := hclsyntax.ParseTemplate(content, path, hcl.InitialPos)
+			if diags.HasErrors() {
+				return cty.UnknownVal(cty.String), diags
+			}
+
+			ctx := &hcl.EvalContext{
+				Variables: vars.AsValueMap(),
+				Functions: funcs,
+			}
+
+			for _, traversal := range expr.Variables() {
+				if _, ok := ctx.Variables[traversal.RootName()]; !ok {
+					return cty.UnknownVal(cty.String), fmt.Errorf("%s: vars map does not contain key %q", traversal.SourceRange(), traversal.RootName())
+				}
+			}
+
+			val, diags := expr.Value(ctx)
+			if diags.HasErrors() {
+				return cty.UnknownVal(cty.String), diags
+			}
+
+			// A template made of a single interpolation evaluates to the
+			// value interpolated, whatever its type.
+			str, err := convert.Convert(val, cty.String)
+			if err != nil {
+				return cty.UnknownVal(cty.String), fmt.Errorf("template %s must produce a string: %w", path, err)
+			}
+
+			return str, nil
+		},
+	})
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+)
+
+// Host is a member of an inventory. Its config is read from the config tree
+// shared by all hosts, with its own variable values.
+type Host struct {
+	Name string
+	// ValueFiles are read after the value files shared by all hosts.
+	ValueFiles []string
+	// Values are applied after ValueFiles.
+	Values hcl.Attributes
+}
+
+type inventoryFile struct {
+	Hosts []hostBlock `hcl:"host,block"`
+}
+
+type hostBlock struct {
+	Name      string         `hcl:"name,label"`
+	VarFiles  []string       `hcl:"var_files,optional"`
+	Variables *hostVariables `hcl:"variables,block"`
+}
+
+type hostVariables struct {
+	Body hcl.Body `hcl:",remain"`
+}
+
+// ReadInventory reads the hosts of an inventory. path is either a hosts file,
+// with a host block for each host, or a directory of value files, each of
+// which holds the values of the host it is named after.
+func ReadInventory(path string) ([]Host, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []Host
+	if info.IsDir() {
+		hosts, err = readInventoryDir(path)
+	} else {
+		hosts, err = readInventoryFile(path)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, host := range hosts {
+		if host.Name == "" || host.Name == "." || host.Name == ".." || strings.ContainsAny(host.Name, `/\`) {
+			return nil, fmt.Errorf("invalid host name %q", host.Name)
+		}
+
+		if seen[host.Name] {
+			return nil, fmt.Errorf("host %q is defined more than once", host.Name)
+		}
+
+		seen[host.Name] = true
+	}
+
+	return hosts, nil
+}
+
+func readInventoryDir(path string) ([]Host, error) {
+	valuePaths, err := resolveFilePath(path, valueExtensions)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := make([]Host, 0, len(valuePaths))
+	for _, valuePath := range valuePaths {
+		name := filepath.Base(valuePath)
+		for _, ext := range valueExtensions {
+			if trimmed, ok := strings.CutSuffix(name, ext); ok {
+				name = trimmed
+				break
+			}
+		}
+
+		hosts = append(hosts, Host{Name: name, ValueFiles: []string{valuePath}})
+	}
+
+	return hosts, nil
+}
+
+// readInventoryFile reads a hosts file. Value files of a host are relative to
+// the hosts file.
+//
+//	host "web-1" {
+//	  var_files = ["values/web.cvars"]
+//
+//	  variables {
+//	    hostname = "web-1"
+//	  }
+//	}
+func readInventoryFile(path string) ([]Host, error) {
+	file, diags := parseFile(path, nil)
+	if diags.HasErrors() {
+		return nil, ParseError{Err: diags, Path: path}
+	}
+
+	var inventory inventoryFile
+	diags = gohcl.DecodeBody(file.Body, buildEvalContext(nil, filepath.Dir(path)), &inventory)
+	if diags.HasErrors() {
+		return nil, ParseError{Err: diags, Path: path}
+	}
+
+	hosts := make([]Host, 0, len(inventory.Hosts))
+	for _, block := range inventory.Hosts {
+		host := Host{Name: block.Name}
+		for _, valuePath := range block.VarFiles {
+			if !filepath.IsAbs(valuePath) {
+				valuePath = filepath.Join(filepath.Dir(path), valuePath)
+			}
+
+			host.ValueFiles = append(host.ValueFiles, valuePath)
+		}
+
+		if block.Variables != nil {
+			attrs, diags := block.Variables.Body.JustAttributes()
+			if diags.HasErrors() {
+				return nil, ParseError{Err: diags, Path: path}
+			}
+
+			host.Values = attrs
+		}
+
+		hosts = append(hosts, host)
+	}
+
+	return hosts, nil
+}
@@ -1,77 +1,205 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 
 	"github.com/hashicorp/hcl/v2"
-	"github.com/hashicorp/hcl/v2/hclsimple"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
 )
 
 var (
 	ErrNoSystemBlock = fmt.Errorf("system block is required")
 )
 
-func MergeConfigs(base, override *ApplianceConfig) *ApplianceConfig {
+type ReadOpt func(*readOptions)
+
+type readOptions struct {
+	Variables map[string]string
+	Environ   []string
+	Values    []hcl.Attributes
+	KeyFiles  []string
+	Files     *FileCache
+}
+
+// WithVariables sets variable values given as raw strings, e.g. from --var flags.
+func WithVariables(vars map[string]string) ReadOpt {
+	return func(o *readOptions) {
+		o.Variables = vars
+	}
+}
+
+// WithEnviron sets the environment searched for COLA_VAR_<name> values.
+func WithEnviron(environ []string) ReadOpt {
+	return func(o *readOptions) {
+		o.Environ = environ
+	}
+}
+
+// WithValues sets variable values as attributes, e.g. from an inventory. They
+// are applied after the values from value files.
+func WithValues(attrs hcl.Attributes) ReadOpt {
+	return func(o *readOptions) {
+		o.Values = append(o.Values, attrs)
+	}
+}
+
+// WithFileCache shares a cache of parsed files between calls to ReadConfig.
+// Without it, each call starts with an empty cache.
+func WithFileCache(cache *FileCache) ReadOpt {
+	return func(o *readOptions) {
+		o.Files = cache
+	}
+}
+
+// WithKeyFiles sets the age identity files used to decrypt encrypted value
+// files and values.
+func WithKeyFiles(paths []string) ReadOpt {
+	return func(o *readOptions) {
+		o.KeyFiles = paths
+	}
+}
+
+// MergeConfigs merges override into base. Attributes of the system and etcd
+// blocks set in override replace those in base, and labeled blocks are added
+// by label. A labeled block defined in both is replaced by the block in
+// override, unless override was read from an override file, in which case the
+// two blocks are merged.
+func MergeConfigs(base, override *ApplianceConfig) (*ApplianceConfig, error) {
+	return mergeConfigs(base, override, false)
+}
+
+// mergeConfigs merges override into base, see MergeConfigs. If override was
+// read from a module, a labeled block defined in both is a conflict instead,
+// and so is a block of the module that a later config replaces.
+func mergeConfigs(base, override *ApplianceConfig, module bool) (*ApplianceConfig, error) {
 	if base == nil {
-		return override
+		base = &ApplianceConfig{}
 	}
 
-	if base.System == nil {
-		base.System = override.System
-	} else {
-		if override.System != nil && override.System.Hostname != "" {
-			base.System.Hostname = override.System.Hostname
-		}
+	if base.sources == nil {
+		base.sources = make(sourceMap)
+	}
 
-		if override.System != nil && override.System.Timezone != "" {
-			base.System.Timezone = override.System.Timezone
-		}
+	if base.sensitiveAttrs == nil {
+		base.sensitiveAttrs = make(sensitiveAttrs)
 	}
 
-	if base.Etcd == nil {
-		base.Etcd = override.Etcd
-	} else {
-		if override.Etcd != nil && override.Etcd.Server {
-			base.Etcd.Server = true
-		}
+	m := &merger{dst: base.sources, src: override.sources, sensitive: base.sensitiveAttrs, module: module}
+	diags := m.mergeBlock(reflect.ValueOf(base).Elem(), reflect.ValueOf(override).Elem(), "")
+	if diags.HasErrors() {
+		return nil, diags
+	}
 
-		if override.Etcd != nil && override.Etcd.Gateway {
-			base.Etcd.Gateway = true
+	for address, source := range override.sources {
+		if _, ok := base.sources[address]; !ok {
+			source.Module = source.Module || module
+			base.sources[address] = source
 		}
+	}
 
-		if override.Etcd != nil && override.Etcd.Name != "" {
-			base.Etcd.Name = override.Etcd.Name
-		}
+	for defRange, attrs := range override.sensitiveAttrs {
+		base.sensitiveAttrs.add(defRange, attrs)
+	}
 
-		if override.Etcd != nil && override.Etcd.ListenAddress != "" {
-			base.Etcd.ListenAddress = override.Etcd.ListenAddress
-		}
+	base.SensitiveValues = append(base.SensitiveValues, override.SensitiveValues...)
 
-		if override.Etcd != nil && override.Etcd.InitialToken != "" {
-			base.Etcd.InitialToken = override.Etcd.InitialToken
-		}
+	return base, nil
+}
 
-		if override.Etcd != nil && len(override.Etcd.Peers) > 0 {
-			base.Etcd.Peers = append(base.Etcd.Peers, override.Etcd.Peers...)
+var (
+	// configExtensions are the extensions of config files, in native and
+	// JSON syntax.
+	configExtensions = []string{".hcl", ".hcl.json"}
+	// valueExtensions are the extensions of variable value files. Terraform
+	// .tfvars files are accepted as they share the syntax of .cvars files.
+	// Any of them may be encrypted with age.
+	valueExtensions = encryptable(".cvars", ".cvars.json", ".tfvars", ".tfvars.json", ".yaml", ".yml")
+	yamlExtensions  = []string{".yaml", ".yml"}
+)
+
+func hasExtension(path string, exts []string) bool {
+	for _, ext := range exts {
+		if strings.HasSuffix(path, ext) {
+			return true
 		}
 	}
 
-	base.Users = append(base.Users, override.Users...)
-	base.Extensions = append(base.Extensions, override.Extensions...)
-	base.Containers = append(base.Containers, override.Containers...)
-	base.Files = append(base.Files, override.Files...)
-	base.Directories = append(base.Directories, override.Directories...)
-	base.Symlinks = append(base.Symlinks, override.Symlinks...)
-	base.Mounts = append(base.Mounts, override.Mounts...)
-	base.Interfaces = append(base.Interfaces, override.Interfaces...)
-	base.Services = append(base.Services, override.Services...)
+	return false
+}
+
+// FileCache caches parsed files by path, so that files read more than once,
+// e.g. for each host of an inventory, are only parsed once. A file is parsed
+// again if its contents change. It is safe for concurrent use.
+type FileCache struct {
+	mu    sync.Mutex
+	files map[string]parsedFile
+}
+
+// NewFileCache returns an empty FileCache.
+func NewFileCache() *FileCache {
+	return &FileCache{files: make(map[string]parsedFile)}
+}
+
+type parsedFile struct {
+	src   []byte
+	file  *hcl.File
+	diags hcl.Diagnostics
+}
+
+// parseFile parses an HCL file in JSON syntax if its name ends in .json,
+// and in native syntax otherwise. Parsed files are kept in cache, unless it
+// is nil.
+func parseFile(path string, cache *FileCache) (*hcl.File, hcl.Diagnostics) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to read file",
+			Detail:   fmt.Sprintf("The configuration file %q could not be read.", path),
+		}}
+	}
+
+	if cache == nil {
+		return parseSource(src, path)
+	}
+
+	cache.mu.Lock()
+	cached, ok := cache.files[path]
+	cache.mu.Unlock()
+
+	if ok && bytes.Equal(cached.src, src) {
+		return cached.file, cached.diags
+	}
+
+	file, diags := parseSource(src, path)
+
+	cache.mu.Lock()
+	cache.files[path] = parsedFile{src: src, file: file, diags: diags}
+	cache.mu.Unlock()
 
-	return base
+	return file, diags
 }
 
-func getFilesInDir(path, ext string) ([]string, error) {
+// parseSource parses the contents of the file at path, in JSON syntax if the
+// name of the file, without the extension of encrypted files, ends in .json.
+func parseSource(src []byte, path string) (*hcl.File, hcl.Diagnostics) {
+	parser := hclparse.NewParser()
+	if strings.HasSuffix(strings.TrimSuffix(path, encryptedExtension), ".json") {
+		return parser.ParseJSON(src, path)
+	}
+
+	return parser.ParseHCL(src, path)
+}
+
+func getFilesInDir(path string, exts []string) ([]string, error) {
 	files, err := os.ReadDir(path)
 	if err != nil {
 		return nil, err
@@ -83,13 +211,13 @@ func getFilesInDir(path, ext string) ([]string, error) {
 		fp := filepath.Join(path, file.Name())
 
 		if file.IsDir() {
-			resolved, err := resolveFilePath(fp, ext)
+			resolved, err := resolveFilePath(fp, exts)
 			if err != nil {
 				return nil, err
 			}
 
 			paths = append(paths, resolved...)
-		} else if filepath.Ext(fp) == ext {
+		} else if hasExtension(fp, exts) {
 			paths = append(paths, fp)
 		}
 	}
@@ -97,14 +225,14 @@ func getFilesInDir(path, ext string) ([]string, error) {
 	return paths, nil
 }
 
-func resolveFilePath(path, ext string) ([]string, error) {
+func resolveFilePath(path string, exts []string) ([]string, error) {
 	fi, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
 
 	if fi.IsDir() {
-		dirPaths, err := getFilesInDir(path, ext)
+		dirPaths, err := getFilesInDir(path, exts)
 		if err != nil {
 			return nil, err
 		}
@@ -114,10 +242,10 @@ func resolveFilePath(path, ext string) ([]string, error) {
 	return []string{path}, nil
 }
 
-func resolveFilePaths(paths []string, ext string) ([]string, error) {
+func resolveFilePaths(paths []string, exts []string) ([]string, error) {
 	filePaths := make([]string, 0)
 	for _, path := range paths {
-		paths, err := resolveFilePath(path, ext)
+		paths, err := resolveFilePath(path, exts)
 		if err != nil {
 			return nil, err
 		}
@@ -128,13 +256,35 @@ func resolveFilePaths(paths []string, ext string) ([]string, error) {
 	return filePaths, nil
 }
 
-func readConfigFile(path string, evalCtx *hcl.EvalContext) (*ApplianceConfig, error) {
-	var config ApplianceConfig
-	err := hclsimple.DecodeFile(path, evalCtx, &config)
+// ConfigFiles returns the config files read by ReadConfig for paths.
+func ConfigFiles(paths []string) ([]string, error) {
+	configPaths, err := resolveFilePaths(paths, configExtensions)
 	if err != nil {
-		return nil, ParseError{Err: err, Path: path}
+		return nil, err
+	}
+
+	return withoutModules(configPaths, nil), nil
+}
+
+func readConfigFile(path string, evalCtx *hcl.EvalContext, sensitive func(hcl.Expression) bool, files *FileCache) (*ApplianceConfig, error) {
+	file, diags := parseFile(path, files)
+	if diags.HasErrors() {
+		return nil, ParseError{Err: diags, Path: path}
+	}
+
+	config := ApplianceConfig{sources: make(sourceMap), sensitiveAttrs: make(sensitiveAttrs)}
+	body := newExpandBody(file.Body, evalCtx, config.sources, sensitive, isOverrideFile(path))
+	diags = gohcl.DecodeBody(body, evalCtx, &config)
+	if diags.HasErrors() {
+		return nil, ParseError{Err: diags, Path: path}
+	}
+
+	for _, source := range config.sources {
+		config.sensitiveAttrs.add(source.DefRange, source.Sensitive)
 	}
 
+	assignRanges(reflect.ValueOf(&config).Elem(), "", config.sources)
+
 	if len(config.Files) > 0 {
 		files := make([]File, len(config.Files))
 		for i, file := range config.Files {
@@ -175,37 +325,99 @@ func readConfigFile(path string, evalCtx *hcl.EvalContext) (*ApplianceConfig, er
 	return &config, nil
 }
 
-func ReadConfig(paths, values []string) (*ApplianceConfig, error) {
-	configPaths, err := resolveFilePaths(paths, ".hcl")
+func ReadConfig(paths, values []string, opts ...ReadOpt) (*ApplianceConfig, error) {
+	options := &readOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	if options.Files == nil {
+		options.Files = NewFileCache()
+	}
+
+	configPaths, err := resolveFilePaths(paths, configExtensions)
 	if err != nil {
 		return nil, err
 	}
 
-	valuePaths, err := resolveFilePaths(values, ".cvars")
+	configPaths = withoutModules(configPaths, options.Files)
+
+	valuePaths, err := resolveFilePaths(values, valueExtensions)
 	if err != nil {
 		return nil, err
 	}
 
-	variables, err := loadVariables(configPaths, valuePaths)
+	variables, sensitiveVars, err := loadVariables(configPaths, valuePaths, options)
 	if err != nil {
 		return nil, err
 	}
 
-	evalCtx := buildEvalContext(variables)
+	merged, err := readModule(configPaths, variables, sensitiveVars, nil, options.Files)
+	if err != nil {
+		return nil, err
+	}
+
+	if merged == nil || merged.System == nil {
+		return nil, ErrNoSystemBlock
+	}
+
+	warnSensitiveFiles(merged)
+
+	return merged, nil
+}
+
+// readModule reads and merges a set of config files once the values of their
+// variables are known. Module blocks within the files are loaded recursively,
+// stack holds the directories of the modules currently being read.
+func readModule(configPaths []string, variables map[string]cty.Value, sensitiveVars map[string]bool, stack []string, files *FileCache) (*ApplianceConfig, error) {
+	locals, sensitiveLocals, err := readLocals(configPaths, variables, sensitiveVars, files)
+	if err != nil {
+		return nil, err
+	}
+
+	modules := make(map[string]struct{})
+	sensitive := func(expr hcl.Expression) bool {
+		return referencesSensitive(expr, sensitiveVars, sensitiveLocals)
+	}
 
 	var merged *ApplianceConfig
-	for _, cPath := range configPaths {
-		config, err := readConfigFile(cPath, evalCtx)
+	for _, cPath := range sortOverrideFiles(configPaths) {
+		evalCtx := buildEvalContext(variables, filepath.Dir(cPath))
+		evalCtx.Variables["local"] = cty.ObjectVal(locals)
+		config, err := readConfigFile(cPath, evalCtx, sensitive, files)
+		if err != nil {
+			return nil, err
+		}
+
+		merged, err = MergeConfigs(merged, config)
 		if err != nil {
 			return nil, err
 		}
 
-		merged = MergeConfigs(merged, config)
+		for _, module := range config.Modules {
+			if _, ok := modules[module.Name]; ok {
+				return nil, fmt.Errorf("module %q is defined more than once", module.Name)
+			}
+			modules[module.Name] = struct{}{}
+
+			moduleConfig, err := loadModule(module, cPath, evalCtx, sensitiveVars, sensitiveLocals, stack, files)
+			if err != nil {
+				return nil, err
+			}
+
+			merged, err = mergeConfigs(merged, moduleConfig, true)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
-	if merged.System == nil {
-		return nil, ErrNoSystemBlock
+	if merged == nil {
+		merged = &ApplianceConfig{}
 	}
 
+	merged.SensitiveValues = append(merged.SensitiveValues, collectSensitive(variables, sensitiveVars)...)
+	merged.SensitiveValues = append(merged.SensitiveValues, collectSensitive(locals, sensitiveLocals)...)
+
 	return merged, nil
 }
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type LocalsPartial struct {
+	Locals []Locals `hcl:"locals,block"`
+	Remain hcl.Body `hcl:",remain"`
+}
+
+// localValue is a single attribute of a locals block along with the
+// directory of the file that defined it.
+type localValue struct {
+	Attr    *hcl.Attribute
+	BaseDir string
+}
+
+// localDependencies returns the names of the locals referenced by an expression.
+func localDependencies(expr hcl.Expression) []string {
+	deps := make([]string, 0)
+	for _, traversal := range expr.Variables() {
+		if traversal.RootName() != "local" || len(traversal) < 2 {
+			continue
+		}
+
+		if attr, ok := traversal[1].(hcl.TraverseAttr); ok {
+			deps = append(deps, attr.Name)
+		}
+	}
+
+	return deps
+}
+
+// referencesSensitive reports whether an expression refers to a sensitive
+// variable or local.
+func referencesSensitive(expr hcl.Expression, sensitiveVars, sensitiveLocals map[string]bool) bool {
+	for _, traversal := range expr.Variables() {
+		if len(traversal) < 2 {
+			continue
+		}
+
+		attr, ok := traversal[1].(hcl.TraverseAttr)
+		if !ok {
+			continue
+		}
+
+		switch traversal.RootName() {
+		case "var":
+			if sensitiveVars[attr.Name] {
+				return true
+			}
+		case "local":
+			if sensitiveLocals[attr.Name] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// readLocals evaluates the locals blocks of all config files. Locals may
+// refer to variables and to each other, in any order and across files.
+// Locals derived from sensitive variables are reported as sensitive too.
+func readLocals(paths []string, variables map[string]cty.Value, sensitiveVars map[string]bool, files *FileCache) (map[string]cty.Value, map[string]bool, error) {
+	defs := make(map[string]localValue)
+
+	for _, path := range paths {
+		var partial LocalsPartial
+
+		file, diags := parseFile(path, files)
+		if diags.HasErrors() {
+			return nil, nil, ParseError{Err: diags, Path: path}
+		}
+
+		diags = gohcl.DecodeBody(file.Body, nil, &partial)
+		if diags.HasErrors() {
+			return nil, nil, ParseError{Err: diags, Path: path}
+		}
+
+		for _, block := range partial.Locals {
+			attrs, diags := block.Body.JustAttributes()
+			if diags.HasErrors() {
+				return nil, nil, diags
+			}
+
+			for name, attr := range attrs {
+				if existing, ok := defs[name]; ok {
+					return nil, nil, hcl.Diagnostics{{
+						Severity: hcl.DiagError,
+						Summary:  "Duplicate local value definition",
+						Detail:   fmt.Sprintf("A local value named %q was already defined at %s.", name, existing.Attr.NameRange),
+						Subject:  attr.NameRange.Ptr(),
+					}}
+				}
+
+				defs[name] = localValue{Attr: attr, BaseDir: filepath.Dir(path)}
+			}
+		}
+	}
+
+	locals := make(map[string]cty.Value)
+	sensitive := make(map[string]bool)
+
+	// Track the locals currently being evaluated to detect cycles.
+	visiting := make(map[string]bool)
+	stack := make([]string, 0)
+
+	var evaluate func(name string) hcl.Diagnostics
+	evaluate = func(name string) hcl.Diagnostics {
+		if _, done := locals[name]; done {
+			return nil
+		}
+
+		def := defs[name]
+
+		if visiting[name] {
+			cycle := append(slices.Clone(stack[slices.Index(stack, name):]), name)
+			return hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  "Cycle in local values",
+				Detail:   fmt.Sprintf("Local values cannot depend on themselves: %s.", strings.Join(cycle, " -> ")),
+				Subject:  def.Attr.Expr.Range().Ptr(),
+			}}
+		}
+
+		visiting[name] = true
+		stack = append(stack, name)
+
+		for _, dep := range localDependencies(def.Attr.Expr) {
+			if _, ok := defs[dep]; !ok {
+				// Left for the evaluation to report as an unsupported attribute.
+				continue
+			}
+
+			if diags := evaluate(dep); diags.HasErrors() {
+				return diags
+			}
+		}
+
+		evalCtx := buildEvalContext(variables, def.BaseDir)
+		evalCtx.Variables["local"] = cty.ObjectVal(locals)
+
+		val, diags := def.Attr.Expr.Value(evalCtx)
+		if diags.HasErrors() {
+			return diags
+		}
+
+		locals[name] = val
+		if referencesSensitive(def.Attr.Expr, sensitiveVars, sensitive) {
+			sensitive[name] = true
+		}
+
+		visiting[name] = false
+		stack = stack[:len(stack)-1]
+
+		return nil
+	}
+
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if diags := evaluate(name); diags.HasErrors() {
+			return nil, nil, diags
+		}
+	}
+
+	return locals, sensitive, nil
+}
@@ -0,0 +1,340 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// unmergedBlocks lists the block types that are appended as-is when configs
+// are merged. They are resolved before merging and checked for duplicates
+// on their own.
+var unmergedBlocks = map[string]bool{
+	"variable": true,
+	"locals":   true,
+	"module":   true,
+}
+
+// isOverrideFile reports whether a config file is an override file, which
+// is merged after all other files.
+func isOverrideFile(path string) bool {
+	name := strings.TrimSuffix(filepath.Base(path), ".json")
+	return name == "override.hcl" || strings.HasSuffix(name, "_override.hcl")
+}
+
+// sortOverrideFiles moves override files after all other files, keeping the
+// order of the files otherwise.
+func sortOverrideFiles(paths []string) []string {
+	sorted := make([]string, 0, len(paths))
+	overrides := make([]string, 0)
+
+	for _, path := range paths {
+		if isOverrideFile(path) {
+			overrides = append(overrides, path)
+		} else {
+			sorted = append(sorted, path)
+		}
+	}
+
+	return append(sorted, overrides...)
+}
+
+// blockSource records where a block was defined, the attributes set in it
+// and which of them are set from sensitive values. Module is set for the
+// blocks of a module once merged into the including config.
+type blockSource struct {
+	DefRange  hcl.Range
+	Attrs     map[string]hcl.Range
+	Sensitive map[string]bool
+	Override  bool
+	Module    bool
+}
+
+// sourceMap holds the sources of the blocks of a config, keyed by their
+// address, e.g. `container "web".volume "/data"`.
+type sourceMap map[string]*blockSource
+
+func (s sourceMap) record(address string, defRange hcl.Range, attrs hcl.Attributes, sensitive func(hcl.Expression) bool, override bool) hcl.Diagnostics {
+	if existing, ok := s[address]; ok {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Duplicate block",
+			Detail:   fmt.Sprintf("The block %s was already defined at %s.", address, existing.DefRange),
+			Subject:  defRange.Ptr(),
+		}}
+	}
+
+	source := &blockSource{
+		DefRange:  defRange,
+		Attrs:     make(map[string]hcl.Range, len(attrs)),
+		Sensitive: make(map[string]bool),
+		Override:  override,
+	}
+
+	for name, attr := range attrs {
+		source.Attrs[name] = attr.Range
+		if sensitive(attr.Expr) {
+			source.Sensitive[name] = true
+		}
+	}
+
+	s[address] = source
+
+	return nil
+}
+
+func nestedAddress(parent, block string) string {
+	if parent == "" {
+		return block
+	}
+
+	return parent + "." + block
+}
+
+// assignRanges sets the DefRange field of v and of its nested blocks to the
+// recorded definition ranges. Once assigned, the sources of unlabeled blocks
+// are removed, as their index only holds within a single file.
+func assignRanges(v reflect.Value, address string, sources sourceMap) {
+	if source, ok := sources[address]; ok {
+		if field := v.FieldByName("DefRange"); field.IsValid() {
+			field.Set(reflect.ValueOf(source.DefRange))
+		}
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, kind, ok := hclTag(t.Field(i))
+		if !ok || kind != "block" || unmergedBlocks[name] {
+			continue
+		}
+
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.Pointer:
+			if !field.IsNil() {
+				assignRanges(field.Elem(), nestedAddress(address, name), sources)
+			}
+		case reflect.Slice:
+			label := labelField(field.Type().Elem())
+			for j := 0; j < field.Len(); j++ {
+				elem := field.Index(j)
+				if label < 0 {
+					nested := nestedAddress(address, fmt.Sprintf("%s[%d]", name, j))
+					assignRanges(elem, nested, sources)
+					sources.remove(nested)
+				} else {
+					assignRanges(elem, nestedAddress(address, fmt.Sprintf("%s %q", name, elem.Field(label).String())), sources)
+				}
+			}
+		}
+	}
+}
+
+// remove deletes the source of a block and of its nested blocks.
+func (s sourceMap) remove(address string) {
+	for key := range s {
+		if key == address || strings.HasPrefix(key, address+".") {
+			delete(s, key)
+		}
+	}
+}
+
+// attrRange returns the range of an attribute of the block at address, or
+// fallback if it was not recorded.
+func (s sourceMap) attrRange(address, name string, fallback hcl.Range) *hcl.Range {
+	if source, ok := s[address]; ok {
+		if rng, ok := source.Attrs[name]; ok {
+			return &rng
+		}
+	}
+
+	return fallback.Ptr()
+}
+
+// hclTag returns the name and kind of the hcl struct tag of a field.
+func hclTag(field reflect.StructField) (string, string, bool) {
+	tag, ok := field.Tag.Lookup("hcl")
+	if !ok {
+		return "", "", false
+	}
+
+	name, kind, _ := strings.Cut(tag, ",")
+	return name, kind, true
+}
+
+// labelField returns the index of the field holding the label of a block
+// type, or -1 if the block has no label.
+func labelField(t reflect.Type) int {
+	for i := 0; i < t.NumField(); i++ {
+		if _, kind, ok := hclTag(t.Field(i)); ok && kind == "label" {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// merger merges the blocks of one config into another.
+type merger struct {
+	dst       sourceMap
+	src       sourceMap
+	sensitive sensitiveAttrs
+	module    bool
+}
+
+// mergeBlock merges the attributes and nested blocks of src into dst, both
+// structs decoded from the block at address. Attributes set in src replace
+// the values in dst.
+func (m *merger) mergeBlock(dst, src reflect.Value, address string) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, kind, ok := hclTag(t.Field(i))
+		if !ok {
+			continue
+		}
+
+		switch kind {
+		case "label", "remain":
+			continue
+		case "block":
+			diags = append(diags, m.mergeNested(dst.Field(i), src.Field(i), address, name)...)
+		default:
+			m.mergeAttr(dst.Field(i), src.Field(i), address, name)
+		}
+	}
+
+	return diags
+}
+
+func (m *merger) mergeAttr(dst, src reflect.Value, address, name string) {
+	srcBlock, dstBlock := m.src[address], m.dst[address]
+	if srcBlock == nil || dstBlock == nil {
+		return
+	}
+
+	srcRange, ok := srcBlock.Attrs[name]
+	if !ok {
+		return
+	}
+
+	if dstRange, ok := dstBlock.Attrs[name]; ok {
+		log.Debug().
+			Str("block", address).
+			Str("attribute", name).
+			Str("previous", dstRange.String()).
+			Str("source", srcRange.String()).
+			Msg("Overriding attribute")
+	}
+
+	dst.Set(src)
+	dstBlock.Attrs[name] = srcRange
+
+	if srcBlock.Sensitive[name] {
+		m.sensitive.add(dstBlock.DefRange, map[string]bool{name: true})
+	} else {
+		delete(m.sensitive[dstBlock.DefRange], name)
+	}
+}
+
+func (m *merger) mergeNested(dst, src reflect.Value, parent, blockType string) hcl.Diagnostics {
+	switch dst.Kind() {
+	case reflect.Pointer:
+		if src.IsNil() {
+			return nil
+		}
+
+		address := nestedAddress(parent, blockType)
+		if dst.IsNil() {
+			if diags := m.checkOverride(parent, address); diags.HasErrors() {
+				return diags
+			}
+
+			dst.Set(src)
+			return nil
+		}
+
+		return m.mergeBlock(dst.Elem(), src.Elem(), address)
+	case reflect.Slice:
+		label := labelField(dst.Type().Elem())
+		if label < 0 || unmergedBlocks[blockType] {
+			dst.Set(reflect.AppendSlice(dst, src))
+			return nil
+		}
+
+		var diags hcl.Diagnostics
+		for i := 0; i < src.Len(); i++ {
+			elem := src.Index(i)
+			address := nestedAddress(parent, fmt.Sprintf("%s %q", blockType, elem.Field(label).String()))
+
+			existing := -1
+			for j := 0; j < dst.Len(); j++ {
+				if dst.Index(j).Field(label).String() == elem.Field(label).String() {
+					existing = j
+					break
+				}
+			}
+
+			if existing < 0 {
+				if checkDiags := m.checkOverride(parent, address); checkDiags.HasErrors() {
+					diags = append(diags, checkDiags...)
+					continue
+				}
+
+				dst.Set(reflect.Append(dst, elem))
+				continue
+			}
+
+			srcBlock, dstBlock := m.src[address], m.dst[address]
+			if srcBlock != nil && dstBlock != nil && !srcBlock.Override {
+				if m.module || dstBlock.Module {
+					diags = append(diags, &hcl.Diagnostic{
+						Severity: hcl.DiagError,
+						Summary:  "Conflicting block definitions",
+						Detail:   fmt.Sprintf("The block %s was already defined at %s. Blocks of a module cannot be replaced, use an override file to change it.", address, dstBlock.DefRange),
+						Subject:  srcBlock.DefRange.Ptr(),
+					})
+					continue
+				}
+
+				log.Debug().
+					Str("block", address).
+					Str("previous", dstBlock.DefRange.String()).
+					Str("source", srcBlock.DefRange.String()).
+					Msg("Replacing block")
+
+				dst.Index(existing).Set(elem)
+				m.dst.remove(address)
+				continue
+			}
+
+			diags = append(diags, m.mergeBlock(dst.Index(existing), elem, address)...)
+		}
+
+		return diags
+	}
+
+	return nil
+}
+
+// checkOverride reports top-level blocks of override files that do not
+// override an existing block. Their required attributes are not enforced,
+// so they cannot stand on their own.
+func (m *merger) checkOverride(parent, address string) hcl.Diagnostics {
+	source := m.src[address]
+	if parent != "" || source == nil || !source.Override {
+		return nil
+	}
+
+	return hcl.Diagnostics{{
+		Severity: hcl.DiagError,
+		Summary:  "Missing base block for override",
+		Detail:   fmt.Sprintf("There is no %s block for this override block to change.", address),
+		Subject:  source.DefRange.Ptr(),
+	}}
+}
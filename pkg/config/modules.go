@@ -0,0 +1,231 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// moduleSources returns the absolute paths of the sources of the module
+// blocks in the given config files. Sources that are not a constant string,
+// and files that fail to parse, are skipped here and reported once the files
+// are read.
+func moduleSources(paths []string, files *FileCache) []string {
+	schema := &hcl.BodySchema{Blocks: []hcl.BlockHeaderSchema{{Type: "module", LabelNames: []string{"name"}}}}
+	sourceSchema := &hcl.BodySchema{Attributes: []hcl.AttributeSchema{{Name: "source"}}}
+
+	sources := make([]string, 0)
+	for _, path := range paths {
+		file, diags := parseFile(path, files)
+		if diags.HasErrors() {
+			continue
+		}
+
+		content, _, _ := file.Body.PartialContent(schema)
+		for _, block := range content.Blocks {
+			blockContent, _, _ := block.Body.PartialContent(sourceSchema)
+			attr, ok := blockContent.Attributes["source"]
+			if !ok {
+				continue
+			}
+
+			v, diags := attr.Expr.Value(buildEvalContext(nil, filepath.Dir(path)))
+			if diags.HasErrors() || v.IsNull() || !v.IsKnown() || v.Type() != cty.String {
+				continue
+			}
+
+			source := v.AsString()
+			if !filepath.IsAbs(source) {
+				source = filepath.Join(filepath.Dir(path), source)
+			}
+
+			if source, err := filepath.Abs(source); err == nil {
+				sources = append(sources, source)
+			}
+		}
+	}
+
+	return sources
+}
+
+// withoutModules removes the files found at the source of a module block from
+// paths. A directory may then hold both a config and the modules it includes,
+// without the files of the modules being read as part of the config.
+func withoutModules(paths []string, files *FileCache) []string {
+	sources := moduleSources(paths, files)
+	if len(sources) == 0 {
+		return paths
+	}
+
+	filtered := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if !withinAny(path, sources) {
+			filtered = append(filtered, path)
+		}
+	}
+
+	return filtered
+}
+
+// ModuleRoot returns the directory of the config that includes the config in
+// dir as a module, following modules included by other modules. Only the
+// config files directly within each parent directory are searched. If no
+// parent includes dir, dir is returned.
+func ModuleRoot(dir string) string {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return dir
+	}
+
+	found := false
+	for parent := filepath.Dir(root); ; parent = filepath.Dir(parent) {
+		entries, err := os.ReadDir(parent)
+		if err == nil {
+			paths := make([]string, 0)
+			for _, entry := range entries {
+				if !entry.IsDir() && hasExtension(entry.Name(), configExtensions) {
+					paths = append(paths, filepath.Join(parent, entry.Name()))
+				}
+			}
+
+			if len(paths) > 0 && withinAny(root, moduleSources(paths, nil)) {
+				root = parent
+				found = true
+			}
+		}
+
+		if filepath.Dir(parent) == parent {
+			break
+		}
+	}
+
+	if !found {
+		return dir
+	}
+
+	return root
+}
+
+// withinAny reports whether path is one of dirs, or lies within one of them.
+func withinAny(path string, dirs []string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(dir, abs)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readModuleInputs evaluates the input attributes of a module block in the
+// scope of the calling file and converts them to the module's variable types.
+// Inputs that refer to sensitive values make the receiving variable sensitive.
+func readModuleInputs(module Module, specs map[string]*variableSpec, evalCtx *hcl.EvalContext, sensitiveVars, sensitiveLocals map[string]bool) (map[string]cty.Value, map[string]hcl.Range, map[string]bool, error) {
+	variables := make(map[string]cty.Value)
+	sources := make(map[string]hcl.Range)
+	sensitive := make(map[string]bool)
+
+	attrs, diags := module.Inputs.JustAttributes()
+	if diags.HasErrors() {
+		return nil, nil, nil, diags
+	}
+
+	for name, attr := range attrs {
+		spec, ok := specs[name]
+		if !ok {
+			return nil, nil, nil, hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  "Unsupported module input",
+				Detail:   fmt.Sprintf("Module %q does not declare a variable named %q.", module.Name, name),
+				Subject:  attr.NameRange.Ptr(),
+			}}
+		}
+
+		v, diags := spec.valueExpr(attr.Expr, evalCtx)
+		if diags.HasErrors() {
+			return nil, nil, nil, diags
+		}
+
+		if v.IsNull() {
+			continue
+		}
+
+		display := spec.displayValue(v)
+		if referencesSensitive(attr.Expr, sensitiveVars, sensitiveLocals) {
+			sensitive[name] = true
+			display = redactedValue
+		}
+
+		log.Debug().
+			Str("module", module.Name).
+			Str("name", name).
+			Str("value", display).
+			Msg("Loaded module input")
+
+		variables[name] = v
+		sources[name] = attr.Expr.Range()
+	}
+
+	return variables, sources, sensitive, nil
+}
+
+// loadModule reads the config files found at the source of a module block.
+// The module has its own variables, which are set from the block's inputs,
+// and its own locals.
+func loadModule(module Module, callerPath string, evalCtx *hcl.EvalContext, sensitiveVars, sensitiveLocals map[string]bool, stack []string, files *FileCache) (*ApplianceConfig, error) {
+	source := module.Source
+	if !filepath.IsAbs(source) {
+		source = filepath.Join(filepath.Dir(callerPath), source)
+	}
+
+	source, err := filepath.Abs(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if slices.Contains(stack, source) {
+		return nil, fmt.Errorf("module %q includes itself: %s", module.Name, source)
+	}
+
+	log.Debug().Str("module", module.Name).Str("source", source).Msg("Loading module")
+
+	configPaths, err := resolveFilePaths([]string{source}, configExtensions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load module %q: %w", module.Name, err)
+	}
+
+	configPaths = withoutModules(configPaths, files)
+
+	specs, err := readVariableConfig(configPaths, files)
+	if err != nil {
+		return nil, err
+	}
+
+	variables, sources, sensitiveInputs, err := readModuleInputs(module, specs, evalCtx, sensitiveVars, sensitiveLocals)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyDefaults(specs, variables, sources); err != nil {
+		return nil, fmt.Errorf("module %q: %w", module.Name, err)
+	}
+
+	sensitive, err := checkVariables(specs, variables, sources, sensitiveInputs)
+	if err != nil {
+		return nil, err
+	}
+
+	return readModule(configPaths, variables, sensitive, append(slices.Clone(stack), source), files)
+}
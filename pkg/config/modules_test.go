@@ -0,0 +1,71 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadConfigDirectoryWithModules(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"modules/monitoring/main.hcl": `
+variable "listen_address" {
+  type = string
+}
+
+variable "port" {
+  type    = number
+  default = 9100
+}
+
+file "/etc/default/node-exporter" {
+  mode   = "0644"
+  inline = "LISTEN=${var.listen_address}:${var.port}\n"
+}
+`,
+		"appliance.hcl": `
+system {
+  hostname = "cola"
+}
+
+variable "address" {
+  type    = string
+  default = "10.0.0.1"
+}
+
+module "monitoring" {
+  source         = "./modules/monitoring"
+  listen_address = var.address
+}
+`,
+	})
+
+	config, err := ReadConfig([]string{dir}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(config.Files) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(config.Files))
+	}
+
+	if got, want := config.Files[0].Inline, "LISTEN=10.0.0.1:9100\n"; got != want {
+		t.Errorf("inline = %q, want %q", got, want)
+	}
+}
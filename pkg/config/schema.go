@@ -1,156 +1,291 @@
 package config
 
-import "github.com/hashicorp/hcl/v2"
-
-const (
-	VariableTypeString string = "string"
-	VariableTypeNumber string = "number"
-	VariableTypeBool   string = "bool"
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
 )
 
 type ApplianceConfig struct {
-	System      *System     `hcl:"system,block"`
-	Etcd        *Etcd       `hcl:"etcd,block"`
-	Users       []User      `hcl:"user,block"`
-	Extensions  []Extension `hcl:"extension,block"`
-	Containers  []Container `hcl:"container,block"`
-	Files       []File      `hcl:"file,block"`
-	Directories []Directory `hcl:"directory,block"`
-	Symlinks    []Symlink   `hcl:"symlink,block"`
-	Mounts      []Mount     `hcl:"mount,block"`
-	Interfaces  []Interface `hcl:"interface,block"`
-	Services    []Service   `hcl:"service,block"`
-	Variables   []Variable  `hcl:"variable,block"`
+	System      *System      `hcl:"system,block"`
+	Etcd        *Etcd        `hcl:"etcd,block"`
+	Users       []User       `hcl:"user,block"`
+	Extensions  []Extension  `hcl:"extension,block"`
+	Containers  []Container  `hcl:"container,block"`
+	Files       []File       `hcl:"file,block"`
+	Directories []Directory  `hcl:"directory,block"`
+	Symlinks    []Symlink    `hcl:"symlink,block"`
+	Mounts      []Mount      `hcl:"mount,block"`
+	Disks       []Disk       `hcl:"disk,block"`
+	Raids       []Raid       `hcl:"raid,block"`
+	Luks        []Luks       `hcl:"luks,block"`
+	Filesystems []Filesystem `hcl:"filesystem,block"`
+	Interfaces  []Interface  `hcl:"interface,block"`
+	Services    []Service    `hcl:"service,block"`
+	Variables   []Variable   `hcl:"variable,block"`
+	Locals      []Locals     `hcl:"locals,block" json:"-"`
+	Modules     []Module     `hcl:"module,block" json:"-"`
+
+	// SensitiveValues holds the primitive values of variables marked as
+	// sensitive. They are redacted whenever the config is encoded as JSON.
+	SensitiveValues []cty.Value `json:"-"`
+
+	// sources records where each block was defined, for merging configs.
+	sources sourceMap
+
+	// sensitiveAttrs records the attributes set from sensitive values.
+	sensitiveAttrs sensitiveAttrs
 }
 
 type System struct {
-	Hostname           string   `hcl:"hostname"`
-	Timezone           string   `hcl:"timezone,optional"`
-	EnableTTYAutoLogin bool     `hcl:"enable_tty_auto_login,optional"`
-	Updates            *Updates `hcl:"updates,block"`
-	PowerProfile       string   `hcl:"power_profile,optional"`
+	Hostname           string     `hcl:"hostname"`
+	Timezone           string     `hcl:"timezone,optional"`
+	EnableTTYAutoLogin bool       `hcl:"enable_tty_auto_login,optional"`
+	Updates            *Updates   `hcl:"updates,block"`
+	Timesyncd          *Timesyncd `hcl:"timesyncd,block"`
+	Swap               *Swap      `hcl:"swap,block"`
+	PowerProfile       string     `hcl:"power_profile,optional"`
+	DefRange           hcl.Range  `json:"-"`
 }
 
 type Updates struct {
-	RebootStrategy string `hcl:"reboot_strategy"`
+	RebootStrategy string    `hcl:"reboot_strategy"`
+	DefRange       hcl.Range `json:"-"`
+}
+
+type Timesyncd struct {
+	Servers         []string  `hcl:"servers,optional"`
+	FallbackServers []string  `hcl:"fallback_servers,optional"`
+	DefRange        hcl.Range `json:"-"`
+}
+
+type Swap struct {
+	Type                 string    `hcl:"type"`
+	Path                 string    `hcl:"path,optional"`
+	SizeMiB              int       `hcl:"size_mib,optional"`
+	Device               string    `hcl:"device,optional"`
+	Priority             int       `hcl:"priority,optional"`
+	RAMFraction          float64   `hcl:"ram_fraction,optional"`
+	CompressionAlgorithm string    `hcl:"compression_algorithm,optional"`
+	DefRange             hcl.Range `json:"-"`
 }
 
 type User struct {
-	Username          string   `hcl:"username,label"`
-	Uid               int      `hcl:"uid,optional"`
-	Groups            []string `hcl:"groups,optional"`
-	HomeDir           string   `hcl:"home_dir,optional"`
-	NoCreateHome      bool     `hcl:"no_create_home,optional"`
-	Shell             string   `hcl:"shell,optional"`
-	SSHAuthorizedKeys []string `hcl:"ssh_authorized_keys,optional"`
+	Username          string    `hcl:"username,label"`
+	Uid               int       `hcl:"uid,optional"`
+	Groups            []string  `hcl:"groups,optional"`
+	HomeDir           string    `hcl:"home_dir,optional"`
+	NoCreateHome      bool      `hcl:"no_create_home,optional"`
+	Shell             string    `hcl:"shell,optional"`
+	SSHAuthorizedKeys []string  `hcl:"ssh_authorized_keys,optional"`
+	DefRange          hcl.Range `json:"-"`
 }
 
 type Extension struct {
-	Name      string `hcl:"name,label"`
-	Version   string `hcl:"version"`
-	Arch      string `hcl:"arch,optional"`
-	BakeryUrl string `hcl:"bakery_url"`
+	Name      string    `hcl:"name,label"`
+	Version   string    `hcl:"version"`
+	Arch      string    `hcl:"arch,optional"`
+	BakeryUrl string    `hcl:"bakery_url"`
+	DefRange  hcl.Range `json:"-"`
 }
 
 type Container struct {
-	Name    string   `hcl:"name,label"`
-	Image   string   `hcl:"image"`
-	Args    []string `hcl:"args,optional"`
-	Volumes []Volume `hcl:"volume,block"`
-	Restart string   `hcl:"restart,optional"`
-	CapAdd  []string `hcl:"cap_add,optional"`
+	Name     string    `hcl:"name,label"`
+	Image    string    `hcl:"image"`
+	Args     []string  `hcl:"args,optional"`
+	Volumes  []Volume  `hcl:"volume,block"`
+	Restart  string    `hcl:"restart,optional"`
+	CapAdd   []string  `hcl:"cap_add,optional"`
+	DefRange hcl.Range `json:"-"`
 }
 
 type Volume struct {
-	Source string `hcl:"source"`
-	Target string `hcl:"target,label"`
+	Source   string    `hcl:"source"`
+	Target   string    `hcl:"target,label"`
+	DefRange hcl.Range `json:"-"`
 }
 
 type File struct {
-	Path       string `hcl:"path,label"`
-	Owner      string `hcl:"owner,optional"`
-	Group      string `hcl:"group,optional"`
-	Mode       string `hcl:"mode"`
-	Inline     string `hcl:"inline,optional"`
-	SourcePath string `hcl:"source_path,optional"`
-	URL        string `hcl:"url,optional"`
-	Overwrite  bool   `hcl:"overwrite,optional"`
+	Path       string    `hcl:"path,label"`
+	Owner      string    `hcl:"owner,optional"`
+	Group      string    `hcl:"group,optional"`
+	Mode       string    `hcl:"mode"`
+	Inline     string    `hcl:"inline,optional"`
+	SourcePath string    `hcl:"source_path,optional"`
+	URL        string    `hcl:"url,optional"`
+	Overwrite  bool      `hcl:"overwrite,optional"`
+	DefRange   hcl.Range `json:"-"`
 }
 
 type Directory struct {
-	Path  string `hcl:"path,label"`
-	Owner string `hcl:"owner,optional"`
-	Group string `hcl:"group,optional"`
-	Mode  string `hcl:"mode"`
+	Path     string    `hcl:"path,label"`
+	Owner    string    `hcl:"owner,optional"`
+	Group    string    `hcl:"group,optional"`
+	Mode     string    `hcl:"mode"`
+	DefRange hcl.Range `json:"-"`
 }
 
 type Symlink struct {
-	Path      string `hcl:"path,label"`
-	Target    string `hcl:"target"`
-	Owner     string `hcl:"owner,optional"`
-	Group     string `hcl:"group,optional"`
-	Overwrite bool   `hcl:"overwrite,optional"`
+	Path      string    `hcl:"path,label"`
+	Target    string    `hcl:"target"`
+	Owner     string    `hcl:"owner,optional"`
+	Group     string    `hcl:"group,optional"`
+	Overwrite bool      `hcl:"overwrite,optional"`
+	DefRange  hcl.Range `json:"-"`
 }
 
 type Mount struct {
-	MountPoint string `hcl:"mount_point,label"`
-	Type       string `hcl:"type"`
-	What       string `hcl:"what"`
-	Where      string `hcl:"where"`
-	Options    string `hcl:"options,optional"`
+	MountPoint string    `hcl:"mount_point,label"`
+	Type       string    `hcl:"type"`
+	What       string    `hcl:"what"`
+	Where      string    `hcl:"where"`
+	Options    string    `hcl:"options,optional"`
+	Automount  bool      `hcl:"automount,optional"`
+	DefRange   hcl.Range `json:"-"`
+}
+
+type Disk struct {
+	Device     string      `hcl:"device,label"`
+	WipeTable  bool        `hcl:"wipe_table,optional"`
+	Partitions []Partition `hcl:"partition,block"`
+	DefRange   hcl.Range   `json:"-"`
+}
+
+type Partition struct {
+	Label              string    `hcl:"label,label"`
+	Number             int       `hcl:"number,optional"`
+	SizeMiB            int       `hcl:"size_mib,optional"`
+	StartMiB           int       `hcl:"start_mib,optional"`
+	TypeGUID           string    `hcl:"type_guid,optional"`
+	GUID               string    `hcl:"guid,optional"`
+	WipePartitionEntry bool      `hcl:"wipe_partition_entry,optional"`
+	Resize             bool      `hcl:"resize,optional"`
+	DefRange           hcl.Range `json:"-"`
+}
+
+type Raid struct {
+	Name     string    `hcl:"name,label"`
+	Level    string    `hcl:"level"`
+	Devices  []string  `hcl:"devices"`
+	Spares   int       `hcl:"spares,optional"`
+	Options  []string  `hcl:"options,optional"`
+	DefRange hcl.Range `json:"-"`
+}
+
+type Luks struct {
+	Name        string    `hcl:"name,label"`
+	Device      string    `hcl:"device"`
+	Label       string    `hcl:"label,optional"`
+	UUID        string    `hcl:"uuid,optional"`
+	Key         string    `hcl:"key,optional"`
+	KeyFileURL  string    `hcl:"key_file_url,optional"`
+	WipeVolume  bool      `hcl:"wipe_volume,optional"`
+	Discard     bool      `hcl:"discard,optional"`
+	Options     []string  `hcl:"options,optional"`
+	OpenOptions []string  `hcl:"open_options,optional"`
+	Clevis      *Clevis   `hcl:"clevis,block"`
+	DefRange    hcl.Range `json:"-"`
+}
+
+type Clevis struct {
+	TPM2      bool      `hcl:"tpm2,optional"`
+	Tang      []Tang    `hcl:"tang,block"`
+	Threshold int       `hcl:"threshold,optional"`
+	DefRange  hcl.Range `json:"-"`
+}
+
+type Tang struct {
+	URL           string    `hcl:"url,label"`
+	Thumbprint    string    `hcl:"thumbprint"`
+	Advertisement string    `hcl:"advertisement,optional"`
+	DefRange      hcl.Range `json:"-"`
+}
+
+type Filesystem struct {
+	Device         string    `hcl:"device,label"`
+	Format         string    `hcl:"format"`
+	Label          string    `hcl:"label,optional"`
+	UUID           string    `hcl:"uuid,optional"`
+	Path           string    `hcl:"path,optional"`
+	WipeFilesystem bool      `hcl:"wipe_filesystem,optional"`
+	Options        []string  `hcl:"options,optional"`
+	MountOptions   []string  `hcl:"mount_options,optional"`
+	DefRange       hcl.Range `json:"-"`
 }
 
 type Interface struct {
-	Name       string   `hcl:"name,optional"`
-	MACAddress string   `hcl:"mac_address,optional"`
-	Gateway    string   `hcl:"gateway,optional"`
-	Address    string   `hcl:"address,optional"`
-	Addresses  []string `hcl:"addresses,optional"`
-	DNS        string   `hcl:"dns,optional"`
-	DHCP       bool     `hcl:"dhcp,optional"`
-	VLANs      []VLAN   `hcl:"vlan,block"`
+	Name       string    `hcl:"name,optional"`
+	MACAddress string    `hcl:"mac_address,optional"`
+	Gateway    string    `hcl:"gateway,optional"`
+	Address    string    `hcl:"address,optional"`
+	Addresses  []string  `hcl:"addresses,optional"`
+	DNS        string    `hcl:"dns,optional"`
+	DHCP       bool      `hcl:"dhcp,optional"`
+	VLANs      []VLAN    `hcl:"vlan,block"`
+	DefRange   hcl.Range `json:"-"`
 }
 
 type VLAN struct {
-	Name    string `hcl:"name,label"`
-	ID      int    `hcl:"id"`
-	Address string `hcl:"address,optional"`
-	Gateway string `hcl:"gateway,optional"`
-	DNS     string `hcl:"dns,optional"`
-	DHCP    bool   `hcl:"dhcp,optional"`
+	Name     string    `hcl:"name,label"`
+	ID       int       `hcl:"id"`
+	Address  string    `hcl:"address,optional"`
+	Gateway  string    `hcl:"gateway,optional"`
+	DNS      string    `hcl:"dns,optional"`
+	DHCP     bool      `hcl:"dhcp,optional"`
+	DefRange hcl.Range `json:"-"`
 }
 
 type Service struct {
-	Name       string   `hcl:"name,label"`
-	Inline     string   `hcl:"inline,optional"`
-	SourcePath string   `hcl:"source_path,optional"`
-	Enabled    bool     `hcl:"enabled,optional"`
-	DropIns    []DropIn `hcl:"drop_in,block"`
+	Name       string    `hcl:"name,label"`
+	Inline     string    `hcl:"inline,optional"`
+	SourcePath string    `hcl:"source_path,optional"`
+	Enabled    bool      `hcl:"enabled,optional"`
+	DropIns    []DropIn  `hcl:"drop_in,block"`
+	DefRange   hcl.Range `json:"-"`
 }
 
 type DropIn struct {
-	Name       string `hcl:"name,label"`
-	Inline     string `hcl:"inline,optional"`
-	SourcePath string `hcl:"source_path,optional"`
+	Name       string    `hcl:"name,label"`
+	Inline     string    `hcl:"inline,optional"`
+	SourcePath string    `hcl:"source_path,optional"`
+	DefRange   hcl.Range `json:"-"`
 }
 
 type Etcd struct {
-	Name          string `hcl:"name"`
-	Server        bool   `hcl:"server,optional"`
-	Gateway       bool   `hcl:"gateway,optional"`
-	ListenAddress string `hcl:"listen_address,optional"`
-	InitialToken  string `hcl:"initial_token,optional"`
-	Peers         []Peer `hcl:"peer,block"`
+	Name          string    `hcl:"name"`
+	Server        bool      `hcl:"server,optional"`
+	Gateway       bool      `hcl:"gateway,optional"`
+	ListenAddress string    `hcl:"listen_address,optional"`
+	InitialToken  string    `hcl:"initial_token,optional"`
+	Peers         []Peer    `hcl:"peer,block"`
+	DefRange      hcl.Range `json:"-"`
 }
 
 type Peer struct {
-	Name    string `hcl:"name,label"`
-	Address string `hcl:"address"`
-	Port    int    `hcl:"port"`
+	Name     string    `hcl:"name,label"`
+	Address  string    `hcl:"address"`
+	Port     int       `hcl:"port"`
+	DefRange hcl.Range `json:"-"`
 }
 
 type Variable struct {
+	Name        string               `hcl:"name,label"`
+	Type        hcl.Expression       `hcl:"type"`
+	Default     hcl.Expression       `hcl:"default,optional"`
+	Sensitive   bool                 `hcl:"sensitive,optional"`
+	Validations []VariableValidation `hcl:"validation,block"`
+}
+
+type Module struct {
 	Name   string   `hcl:"name,label"`
-	Type   string   `hcl:"type"`
-	Remain hcl.Body `hcl:",remain"`
+	Source string   `hcl:"source"`
+	Inputs hcl.Body `hcl:",remain"`
+}
+
+type Locals struct {
+	Body hcl.Body `hcl:",remain"`
+}
+
+type VariableValidation struct {
+	Condition    hcl.Expression `hcl:"condition"`
+	ErrorMessage hcl.Expression `hcl:"error_message"`
 }
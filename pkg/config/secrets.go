@@ -0,0 +1,138 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// encryptedExtension is appended to the name of value files encrypted with
+// age, e.g. secrets.cvars.age.
+const encryptedExtension = ".age"
+
+// encryptable returns exts followed by the extensions of the same files when
+// encrypted.
+func encryptable(exts ...string) []string {
+	all := append([]string{}, exts...)
+	for _, ext := range exts {
+		all = append(all, ext+encryptedExtension)
+	}
+
+	return all
+}
+
+// isEncrypted reports whether a value holds an ASCII-armored age message.
+func isEncrypted(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), armor.Header)
+}
+
+// decrypter decrypts age-encrypted value files and values with the identities
+// in key files. Key files are only read once something needs decrypting.
+type decrypter struct {
+	keyFiles   []string
+	identities []age.Identity
+	// decrypted holds the names of the variables given an encrypted value.
+	decrypted map[string]bool
+}
+
+func newDecrypter(keyFiles []string) *decrypter {
+	return &decrypter{keyFiles: keyFiles, decrypted: make(map[string]bool)}
+}
+
+func (d *decrypter) loadIdentities() error {
+	if d.identities != nil {
+		return nil
+	}
+
+	if len(d.keyFiles) == 0 {
+		return fmt.Errorf("no age key file was given")
+	}
+
+	for _, path := range d.keyFiles {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to read key file: %w", err)
+		}
+
+		identities, err := age.ParseIdentities(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read key file %s: %w", path, err)
+		}
+
+		d.identities = append(d.identities, identities...)
+	}
+
+	return nil
+}
+
+// decrypt decrypts an age message, which may be ASCII-armored.
+func (d *decrypter) decrypt(ciphertext []byte) ([]byte, error) {
+	if err := d.loadIdentities(); err != nil {
+		return nil, err
+	}
+
+	var src io.Reader = bytes.NewReader(ciphertext)
+	if isEncrypted(string(ciphertext)) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimSpace(ciphertext)))
+	}
+
+	r, err := age.Decrypt(src, d.identities...)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(r)
+}
+
+// decryptFile returns the contents of an encrypted value file.
+func (d *decrypter) decryptFile(path string) ([]byte, hcl.Diagnostics) {
+	ciphertext, err := os.ReadFile(path)
+	if err != nil {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to read file",
+			Detail:   fmt.Sprintf("The file %q could not be read: %s.", path, err),
+		}}
+	}
+
+	plaintext, err := d.decrypt(ciphertext)
+	if err != nil {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to decrypt file",
+			Detail:   fmt.Sprintf("The file %q could not be decrypted: %s.", path, err),
+		}}
+	}
+
+	return plaintext, nil
+}
+
+// decryptExpr returns the plaintext of a value given as an armored age
+// message, and whether the value was encrypted. A single trailing newline is
+// removed from the plaintext.
+func (d *decrypter) decryptExpr(expr hcl.Expression) (string, bool, hcl.Diagnostics) {
+	v, diags := expr.Value(nil)
+	if diags.HasErrors() || !v.IsKnown() || v.IsNull() || !v.Type().Equals(cty.String) || !isEncrypted(v.AsString()) {
+		return "", false, nil
+	}
+
+	plaintext, err := d.decrypt([]byte(v.AsString()))
+	if err != nil {
+		return "", true, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to decrypt value",
+			Detail:   fmt.Sprintf("The value could not be decrypted: %s.", err),
+			Subject:  expr.Range().Ptr(),
+		}}
+	}
+
+	return strings.TrimSuffix(string(plaintext), "\n"), true, nil
+}
@@ -0,0 +1,251 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+const redactedValue = "(sensitive value)"
+
+// sensitiveLeaves collects every non-null primitive value within a value,
+// descending into collections and structural types. Empty strings are
+// skipped, as they reveal nothing.
+func sensitiveLeaves(v cty.Value) []cty.Value {
+	if v.IsNull() || !v.IsWhollyKnown() {
+		return nil
+	}
+
+	ty := v.Type()
+	switch {
+	case ty == cty.String:
+		if v.AsString() == "" {
+			return nil
+		}
+		return []cty.Value{v}
+	case ty == cty.Number || ty == cty.Bool:
+		return []cty.Value{v}
+	case ty.IsListType() || ty.IsSetType() || ty.IsMapType() || ty.IsTupleType() || ty.IsObjectType():
+		values := make([]cty.Value, 0)
+		for it := v.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			values = append(values, sensitiveLeaves(elem)...)
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// collectSensitive gathers the sensitive values of the named values.
+func collectSensitive(values map[string]cty.Value, names map[string]bool) []cty.Value {
+	sensitive := make([]cty.Value, 0)
+	for name := range names {
+		sensitive = append(sensitive, sensitiveLeaves(values[name])...)
+	}
+
+	return sensitive
+}
+
+// sensitiveText returns the text of the sensitive strings and numbers, as
+// they appear when interpolated into a string. Bools are left out, since
+// "true" and "false" are too common to tell apart from other text.
+func sensitiveText(sensitive []cty.Value) []string {
+	text := make([]string, 0, len(sensitive))
+	for _, v := range sensitive {
+		if v.Type() == cty.Bool {
+			continue
+		}
+
+		s, err := convert.Convert(v, cty.String)
+		if err != nil {
+			continue
+		}
+		text = append(text, s.AsString())
+	}
+
+	return text
+}
+
+// sensitiveStrings returns the sensitive values that are strings.
+func sensitiveStrings(sensitive []cty.Value) []string {
+	strs := make([]string, 0, len(sensitive))
+	for _, v := range sensitive {
+		if v.Type() == cty.String {
+			strs = append(strs, v.AsString())
+		}
+	}
+
+	return strs
+}
+
+// redactString replaces every occurrence of a sensitive value in s.
+func redactString(s string, sensitive []cty.Value) string {
+	for _, value := range sensitiveText(sensitive) {
+		s = strings.ReplaceAll(s, value, redactedValue)
+	}
+
+	return s
+}
+
+// sensitiveAttrs holds the names of the attributes set from sensitive values,
+// keyed by the definition range of their block. Unlike the sources of a
+// config, they are kept for unlabeled blocks, as the range identifies a block
+// across merges.
+type sensitiveAttrs map[hcl.Range]map[string]bool
+
+func (s sensitiveAttrs) add(defRange hcl.Range, attrs map[string]bool) {
+	if len(attrs) == 0 {
+		return
+	}
+
+	if s[defRange] == nil {
+		s[defRange] = make(map[string]bool, len(attrs))
+	}
+
+	for name := range attrs {
+		s[defRange][name] = true
+	}
+}
+
+// MarshalJSON encodes the config with the values of sensitive variables
+// redacted, so that it is safe to include in log output.
+func (c ApplianceConfig) MarshalJSON() ([]byte, error) {
+	type plain ApplianceConfig
+	data, err := json.Marshal(plain(c))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.SensitiveValues) == 0 && len(c.sensitiveAttrs) == 0 {
+		return data, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var tree any
+	if err := dec.Decode(&tree); err != nil {
+		return nil, err
+	}
+
+	redactAttrs(reflect.ValueOf(c), tree, c.sensitiveAttrs)
+
+	return json.Marshal(redactTree(tree, sensitiveStrings(c.SensitiveValues)))
+}
+
+// redactAttrs replaces the attributes set from sensitive values in tree, the
+// decoded JSON encoding of v, whatever their type.
+func redactAttrs(v reflect.Value, tree any, sensitive sensitiveAttrs) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			redactAttrs(v.Elem(), tree, sensitive)
+		}
+	case reflect.Slice:
+		elems, ok := tree.([]any)
+		if !ok {
+			return
+		}
+
+		for i := 0; i < v.Len() && i < len(elems); i++ {
+			redactAttrs(v.Index(i), elems[i], sensitive)
+		}
+	case reflect.Struct:
+		obj, ok := tree.(map[string]any)
+		if !ok {
+			return
+		}
+
+		var attrs map[string]bool
+		if field := v.FieldByName("DefRange"); field.IsValid() {
+			attrs = sensitive[field.Interface().(hcl.Range)]
+		}
+
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, kind, ok := hclTag(t.Field(i))
+			if !ok {
+				continue
+			}
+
+			key := t.Field(i).Name
+			elem, ok := obj[key]
+			if !ok || elem == nil {
+				continue
+			}
+
+			switch kind {
+			case "label", "remain":
+			case "block":
+				redactAttrs(v.Field(i), elem, sensitive)
+			default:
+				if attrs[name] {
+					obj[key] = redactedValue
+				}
+			}
+		}
+	}
+}
+
+// redactTree replaces the strings in a decoded JSON document that embed a
+// sensitive string. Only values are replaced, never object keys, and a value
+// is always replaced as a whole.
+func redactTree(tree any, text []string) any {
+	switch v := tree.(type) {
+	case map[string]any:
+		for k, elem := range v {
+			v[k] = redactTree(elem, text)
+		}
+	case []any:
+		for i, elem := range v {
+			v[i] = redactTree(elem, text)
+		}
+	case string:
+		if containsSensitive(v, text) {
+			return redactedValue
+		}
+	}
+
+	return tree
+}
+
+func containsSensitive(s string, sensitive []string) bool {
+	for _, value := range sensitive {
+		if strings.Contains(s, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// warnSensitiveFiles logs a warning for every inline file that embeds a
+// sensitive value while being accessible to users other than its owner.
+func warnSensitiveFiles(config *ApplianceConfig) {
+	text := sensitiveText(config.SensitiveValues)
+	if len(text) == 0 {
+		return
+	}
+
+	for _, file := range config.Files {
+		if file.Inline == "" || !containsSensitive(file.Inline, text) {
+			continue
+		}
+
+		mode, err := strconv.ParseInt(file.Mode, 8, 32)
+		if err != nil || mode&0o077 != 0 {
+			log.Warn().
+				Str("path", file.Path).
+				Str("mode", file.Mode).
+				Msg("File contains a sensitive value but is not mode 0600")
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+// attributeEnums lists the allowed values of attributes, keyed by the path
+// of block types leading to the attribute.
+var attributeEnums = map[string][]string{
+	"system.power_profile":              validPowerProfiles,
+	"system.updates.reboot_strategy":    validRebootStrategies,
+	"system.swap.type":                  validSwapTypes,
+	"system.swap.compression_algorithm": validZramAlgorithms,
+	"container.restart":                 validRestartPolicies,
+	"filesystem.format":                 validFilesystemFormats,
+	"raid.level":                        validRaidLevels,
+}
+
+// NestingMode is how the blocks of a type are decoded.
+type NestingMode int
+
+const (
+	NestingSingle NestingMode = iota
+	NestingList
+	NestingMap
+)
+
+// BlockSpec describes a block type of the config, as derived from the hcl
+// struct tags of the type it decodes into.
+type BlockSpec struct {
+	Type    string
+	Label   string
+	Nesting NestingMode
+	Attrs   []AttrSpec
+	Blocks  []*BlockSpec
+	// Remain is set for blocks that accept arbitrary attributes.
+	Remain      bool
+	Description string
+}
+
+// AttrSpec describes an attribute of a block type.
+type AttrSpec struct {
+	Name     string
+	Type     cty.Type
+	Required bool
+	Enum     []string
+	// Meta is set for meta-arguments, which are evaluated before decoding.
+	Meta        bool
+	Description string
+}
+
+var expressionType = reflect.TypeOf((*hcl.Expression)(nil)).Elem()
+
+// Spec returns the spec of the top-level body of a config file.
+func Spec() *BlockSpec {
+	return structSpec(reflect.TypeOf(ApplianceConfig{}), &BlockSpec{}, "")
+}
+
+func structSpec(t reflect.Type, spec *BlockSpec, path string) *BlockSpec {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, kind, ok := hclTag(field)
+		if !ok {
+			continue
+		}
+
+		switch kind {
+		case "label":
+			spec.Label = name
+		case "remain":
+			spec.Remain = true
+		case "block":
+			spec.Blocks = append(spec.Blocks, nestedSpec(field.Type, name, path))
+		default:
+			ty := cty.DynamicPseudoType
+			if field.Type != expressionType {
+				ty, _ = gocty.ImpliedType(reflect.Zero(field.Type).Interface())
+			}
+
+			spec.Attrs = append(spec.Attrs, AttrSpec{
+				Name:        name,
+				Type:        ty,
+				Required:    kind != "optional",
+				Enum:        attributeEnums[nestedPath(path, name)],
+				Description: attributeDescriptions[nestedPath(path, name)],
+			})
+		}
+	}
+
+	return spec
+}
+
+func nestedSpec(t reflect.Type, blockType, parent string) *BlockSpec {
+	path := nestedPath(parent, blockType)
+	spec := &BlockSpec{Type: blockType, Description: blockDescriptions[path]}
+
+	if t.Kind() == reflect.Slice {
+		spec.Nesting = NestingList
+	}
+
+	structSpec(t.Elem(), spec, path)
+	if spec.Nesting == NestingList && spec.Label != "" {
+		spec.Nesting = NestingMap
+	}
+
+	// Meta-arguments are handled before decoding, so they are not part of
+	// the block structs. Variable and locals blocks are not expanded at all.
+	root, _, _ := strings.Cut(path, ".")
+	if root == "variable" || root == "locals" {
+		return spec
+	}
+
+	for _, name := range metaAttributes(blockType, parent == "") {
+		ty := cty.DynamicPseudoType
+		if name == conditionAttribute(blockType) {
+			ty = cty.Bool
+		}
+
+		spec.Attrs = append(spec.Attrs, AttrSpec{Name: name, Type: ty, Meta: true, Description: metaDescriptions[name]})
+	}
+
+	if labelAttr := repeatableBlocks[blockType]; parent == "" && labelAttr != "" {
+		spec.Attrs = append(spec.Attrs, AttrSpec{Name: labelAttr, Type: cty.String, Meta: true, Description: labelDescription})
+	}
+
+	return spec
+}
+
+func nestedPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+
+	return parent + "." + name
+}
+
+// JSONSchema returns a JSON Schema describing config files written in the
+// JSON syntax of HCL. As any value can be given as a "${...}" template,
+// strings are accepted wherever another type is expected.
+func JSONSchema() ([]byte, error) {
+	schema := bodySchema(Spec())
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "cola appliance configuration"
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func bodySchema(spec *BlockSpec) map[string]any {
+	properties := map[string]any{
+		// Comments in the JSON syntax of HCL.
+		"//": map[string]any{},
+	}
+	required := make([]string, 0)
+
+	for _, attr := range spec.Attrs {
+		properties[attr.Name] = attrSchema(attr)
+		if attr.Required {
+			required = append(required, attr.Name)
+		}
+	}
+
+	for _, block := range spec.Blocks {
+		properties[block.Type] = blockSchema(block)
+	}
+
+	schema := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": spec.Remain,
+	}
+
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+
+	if spec.Description != "" {
+		schema["description"] = spec.Description
+	}
+
+	return schema
+}
+
+func blockSchema(spec *BlockSpec) map[string]any {
+	body := bodySchema(spec)
+	bodies := map[string]any{
+		"anyOf": []any{body, map[string]any{"type": "array", "items": body}},
+	}
+
+	switch spec.Nesting {
+	case NestingMap:
+		return map[string]any{
+			"type":                 "object",
+			"description":          fmt.Sprintf("%s blocks, keyed by %s.", spec.Type, spec.Label),
+			"additionalProperties": bodies,
+		}
+	case NestingList:
+		return bodies
+	default:
+		return body
+	}
+}
+
+func attrSchema(attr AttrSpec) map[string]any {
+	var schema map[string]any
+	if len(attr.Enum) > 0 {
+		schema = map[string]any{"enum": attr.Enum}
+	} else {
+		schema = typeSchema(attr.Type)
+	}
+
+	if !(attr.Type.Equals(cty.String) && len(attr.Enum) == 0 || attr.Type.Equals(cty.DynamicPseudoType)) {
+		schema = map[string]any{
+			"anyOf": []any{schema, map[string]any{"type": "string", "pattern": `\$\{`}},
+		}
+	}
+
+	if attr.Description != "" {
+		schema["description"] = attr.Description
+	}
+
+	return schema
+}
+
+func typeSchema(ty cty.Type) map[string]any {
+	switch {
+	case ty.Equals(cty.String):
+		return map[string]any{"type": "string"}
+	case ty.Equals(cty.Bool):
+		return map[string]any{"type": "boolean"}
+	case ty.Equals(cty.Number):
+		return map[string]any{"type": "number"}
+	case ty.IsListType() || ty.IsSetType():
+		return map[string]any{"type": "array", "items": typeSchema(ty.ElementType())}
+	case ty.IsMapType():
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(ty.ElementType())}
+	default:
+		return map[string]any{}
+	}
+}
+
+// HCLDecSpec returns an hcldec spec describing the blocks and attributes of
+// config files once meta-arguments have been applied. The variable, locals
+// and module blocks, and the meta-arguments, are resolved before decoding
+// and cannot be described by a spec, so they are left out.
+func HCLDecSpec() []byte {
+	file := hclwrite.NewEmptyFile()
+	root := file.Body().AppendNewBlock("object", nil).Body()
+	writeBodySpec(root, Spec())
+
+	return hclwrite.Format(file.Bytes())
+}
+
+func writeBodySpec(body *hclwrite.Body, spec *BlockSpec) {
+	for _, attr := range spec.Attrs {
+		if attr.Meta {
+			continue
+		}
+
+		if len(attr.Enum) > 0 {
+			body.AppendUnstructuredTokens(hclwrite.Tokens{
+				{Type: hclsyntax.TokenComment, Bytes: []byte(fmt.Sprintf("# One of: %s\n", strings.Join(attr.Enum, ", ")))},
+			})
+		}
+
+		attrBody := body.AppendNewBlock("attr", []string{attr.Name}).Body()
+		attrBody.SetAttributeValue("name", cty.StringVal(attr.Name))
+		attrBody.SetAttributeRaw("type", hclwrite.Tokens{
+			{Type: hclsyntax.TokenIdent, Bytes: []byte(typeexpr.TypeString(attr.Type))},
+		})
+
+		if attr.Required {
+			attrBody.SetAttributeValue("required", cty.True)
+		}
+	}
+
+	for _, block := range spec.Blocks {
+		if unmergedBlocks[block.Type] {
+			continue
+		}
+
+		var blockBody *hclwrite.Body
+		switch block.Nesting {
+		case NestingMap:
+			blockBody = body.AppendNewBlock("block_map", []string{block.Type}).Body()
+			blockBody.SetAttributeValue("block_type", cty.StringVal(block.Type))
+			blockBody.SetAttributeValue("labels", cty.ListVal([]cty.Value{cty.StringVal(block.Label)}))
+		case NestingList:
+			blockBody = body.AppendNewBlock("block_list", []string{block.Type}).Body()
+			blockBody.SetAttributeValue("block_type", cty.StringVal(block.Type))
+		default:
+			blockBody = body.AppendNewBlock("block", []string{block.Type}).Body()
+			blockBody.SetAttributeValue("block_type", cty.StringVal(block.Type))
+		}
+
+		writeBodySpec(blockBody.AppendNewBlock("object", nil).Body(), block)
+	}
+}
@@ -2,35 +2,63 @@ package config
 
 import (
 	"fmt"
+	"net/url"
+	"path"
+	"regexp"
 	"slices"
 	"strings"
+	"time"
+	"unicode/utf8"
+	// The tz database is embedded so that timezones are checked the same way
+	// whatever the host cola runs on.
+	_ "time/tzdata"
+
+	"github.com/hashicorp/hcl/v2"
 )
 
-func ValidateConfig(config *ApplianceConfig) error {
+// ValidateConfig checks a merged config and returns all problems found,
+// located in the config files. Only diagnostics with error severity make the
+// config invalid; warnings point out settings that are likely mistakes.
+func ValidateConfig(config *ApplianceConfig) hcl.Diagnostics {
 	if config.System == nil {
-		return ErrNoSystemBlock
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Missing system block",
+			Detail:   ErrNoSystemBlock.Error(),
+		}}
 	}
 
+	var diags hcl.Diagnostics
 	for _, validator := range validators {
-		if err := validator(config); err != nil {
-			return err
-		}
+		diags = append(diags, validator(config)...)
 	}
 
-	return nil
+	// Messages may quote the values they complain about.
+	for _, diag := range diags {
+		diag.Summary = redactString(diag.Summary, config.SensitiveValues)
+		diag.Detail = redactString(diag.Detail, config.SensitiveValues)
+	}
+
+	return diags
 }
 
-var validators = []func(*ApplianceConfig) error{
+var validators = []func(*ApplianceConfig) hcl.Diagnostics{
 	validateSystem,
 	validateUsers,
 	validateExtensions,
 	validateContainers,
 	validateFiles,
 	validateDirectories,
-	// validateMounts,
+	validateMounts,
+	validateDisks,
+	validateRaids,
+	validateLuks,
+	validateFilesystems,
 	validateInterfaces,
 	validateServices,
 	validateUpdate,
+	validateTimesyncd,
+	validateSwap,
 }
 
 // etcd-lock    Reboot after first taking a distributed lock in etcd (reboot window applies)
@@ -45,209 +73,536 @@ var validRebootStrategies = []string{"off", "reboot", "etcd-lock"}
 // userspace      Controlled by a userspace application via the `scaling_setspeed` file
 var validPowerProfiles = []string{"performance", "ondemand", "conservative", "powersave", "userspace"}
 
-func validateSystem(config *ApplianceConfig) error {
-	if config.System.Updates != nil {
-		valid := slices.Contains(validRebootStrategies, config.System.Updates.RebootStrategy)
+// always    Restart the container whenever it exits
+// no        Never restart the container
+var validRestartPolicies = []string{"always", "no"}
+
+// file        Swap to a file, created on first boot
+// partition   Swap to a partition, formatted while provisioning
+// zram        Swap to compressed RAM, set up by zram-generator
+var validSwapTypes = []string{"file", "partition", "zram"}
+
+var validZramAlgorithms = []string{"lzo", "lzo-rle", "lz4", "lz4hc", "zstd", "deflate", "842"}
+
+// ext4, btrfs, xfs, vfat   Create a file system of that type
+// swap                     Create a swap area
+// none                     Erase any file system on the device
+var validFilesystemFormats = []string{"ext4", "btrfs", "xfs", "vfat", "swap", "none"}
+
+var validRaidLevels = []string{"linear", "raid0", "raid1", "raid4", "raid5", "raid6", "raid10"}
+
+// raidMinDevices is the minimum number of devices of an array of each level.
+var raidMinDevices = map[string]int{
+	"linear": 1,
+	"raid0":  2,
+	"raid1":  2,
+	"raid4":  3,
+	"raid5":  3,
+	"raid6":  4,
+	"raid10": 2,
+}
+
+var guidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ValidTimezone reports whether name is a zone of the tz database, e.g.
+// "Europe/Berlin".
+func ValidTimezone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// invalid returns an error diagnostic for a problem at subject.
+func invalid(subject *hcl.Range, summary, detail string, args ...any) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  summary,
+		Detail:   fmt.Sprintf(detail, args...),
+		Subject:  subject,
+	}
+}
+
+// warning returns a warning diagnostic for a likely mistake at subject.
+func warning(subject *hcl.Range, summary, detail string, args ...any) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary:  summary,
+		Detail:   fmt.Sprintf(detail, args...),
+		Subject:  subject,
+	}
+}
+
+// labeledAddress returns the address of a labeled block, as recorded in the
+// sources of a config.
+func labeledAddress(blockType, label string) string {
+	return fmt.Sprintf("%s %q", blockType, label)
+}
+
+func validateSystem(config *ApplianceConfig) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	if updates := config.System.Updates; updates != nil && updates.RebootStrategy != "" {
+		valid := slices.Contains(validRebootStrategies, updates.RebootStrategy)
 		if !valid {
-			return fmt.Errorf("system.updates.reboot_strategy must be one of: %s", strings.Join(validRebootStrategies, ", "))
+			subject := config.sources.attrRange("system.updates", "reboot_strategy", updates.DefRange)
+			diags = append(diags, invalid(subject, "Invalid reboot strategy", "system.updates.reboot_strategy must be one of: %s", strings.Join(validRebootStrategies, ", ")))
 		}
 	}
 
+	if config.System.Timezone != "" && !ValidTimezone(config.System.Timezone) {
+		subject := config.sources.attrRange("system", "timezone", config.System.DefRange)
+		diags = append(diags, invalid(subject, "Invalid timezone", "system.timezone: %q is not a zone of the tz database", config.System.Timezone))
+	}
+
 	if config.System.PowerProfile != "" {
 		valid := slices.Contains(validPowerProfiles, config.System.PowerProfile)
 		if !valid {
-			return fmt.Errorf("system.power-profile must be one of: %s", strings.Join(validPowerProfiles, ", "))
+			subject := config.sources.attrRange("system", "power_profile", config.System.DefRange)
+			diags = append(diags, invalid(subject, "Invalid power profile", "system.power_profile must be one of: %s", strings.Join(validPowerProfiles, ", ")))
 		}
 	}
 
-	return nil
+	return diags
 }
 
-func validateUsers(config *ApplianceConfig) error {
-	for i, user := range config.Users {
+func validateUsers(config *ApplianceConfig) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for _, user := range config.Users {
 		if user.Username == "" {
-			return fmt.Errorf("user[%d].username is required", i)
+			diags = append(diags, invalid(user.DefRange.Ptr(), "Missing username", "user.username is required"))
 		}
 	}
 
-	return nil
+	return diags
 }
 
-func validateExtensions(config *ApplianceConfig) error {
-	for i, extension := range config.Extensions {
+func validateExtensions(config *ApplianceConfig) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for _, extension := range config.Extensions {
 		if extension.Name == "" {
-			return fmt.Errorf("extension[%d].name is required", i)
+			diags = append(diags, invalid(extension.DefRange.Ptr(), "Missing extension name", "extension.name is required"))
 		}
 
 		if extension.Version == "" {
-			return fmt.Errorf("extension[%d].version is required", i)
+			diags = append(diags, invalid(extension.DefRange.Ptr(), "Missing extension version", "extension %q: version is required", extension.Name))
 		}
 
 		if extension.BakeryUrl == "" {
-			return fmt.Errorf("extension[%d].bakery_url is required", i)
+			diags = append(diags, invalid(extension.DefRange.Ptr(), "Missing bakery URL", "extension %q: bakery_url is required", extension.Name))
 		}
 	}
 
-	return nil
+	return diags
 }
 
-func validateContainers(config *ApplianceConfig) error {
-	for i, container := range config.Containers {
+func validateContainers(config *ApplianceConfig) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for _, container := range config.Containers {
 		if container.Name == "" {
-			return fmt.Errorf("container[%d].name is required", i)
+			diags = append(diags, invalid(container.DefRange.Ptr(), "Missing container name", "container.name is required"))
 		}
 
 		if container.Image == "" {
-			return fmt.Errorf("container[%d].image is required", i)
+			diags = append(diags, invalid(container.DefRange.Ptr(), "Missing container image", "container %q: image is required", container.Name))
 		}
 
-		if container.Restart != "" && container.Restart != "always" && container.Restart != "no" {
-			return fmt.Errorf("container[%d].restart must be 'always' or 'no'", i)
+		if container.Restart != "" && !slices.Contains(validRestartPolicies, container.Restart) {
+			subject := config.sources.attrRange(labeledAddress("container", container.Name), "restart", container.DefRange)
+			diags = append(diags, invalid(subject, "Invalid restart policy", "container %q: restart must be one of: %s", container.Name, strings.Join(validRestartPolicies, ", ")))
 		}
 	}
 
-	return nil
+	return diags
 }
 
-func validateFiles(config *ApplianceConfig) error {
-	for i, file := range config.Files {
+func validateFiles(config *ApplianceConfig) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for _, file := range config.Files {
 		if file.Path == "" {
-			return fmt.Errorf("file[%d].path is required", i)
+			diags = append(diags, invalid(file.DefRange.Ptr(), "Missing file path", "file.path is required"))
 		}
 
 		if file.Mode == "" {
-			return fmt.Errorf("file[%d].mode is required", i)
+			diags = append(diags, invalid(file.DefRange.Ptr(), "Missing file mode", "file %q: mode is required", file.Path))
+		}
+
+		sources := 0
+		for _, source := range []string{file.Inline, file.SourcePath, file.URL} {
+			if source != "" {
+				sources++
+			}
+		}
+
+		if sources > 1 {
+			diags = append(diags, warning(file.DefRange.Ptr(), "Multiple file contents", "file %q: only one of inline, source_path or url is used, in that order of precedence", file.Path))
 		}
 	}
 
-	return nil
+	return diags
 }
 
-func validateDirectories(config *ApplianceConfig) error {
-	for i, directory := range config.Directories {
+func validateDirectories(config *ApplianceConfig) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for _, directory := range config.Directories {
 		if directory.Path == "" {
-			return fmt.Errorf("directory[%d].path is required", i)
+			diags = append(diags, invalid(directory.DefRange.Ptr(), "Missing directory path", "directory.path is required"))
 		}
 
 		if directory.Mode == "" {
-			return fmt.Errorf("directory[%d].mode is required", i)
+			diags = append(diags, invalid(directory.DefRange.Ptr(), "Missing directory mode", "directory %q: mode is required", directory.Path))
 		}
 	}
 
-	return nil
+	return diags
+}
+
+func validateMounts(config *ApplianceConfig) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	seen := make(map[string]bool)
+	for _, mount := range config.Mounts {
+		address := labeledAddress("mount", mount.MountPoint)
+		subject := func(attr string) *hcl.Range {
+			return config.sources.attrRange(address, attr, mount.DefRange)
+		}
+
+		if mount.What == "" || strings.ContainsAny(mount.What, "\n") {
+			diags = append(diags, invalid(subject("what"), "Invalid mount source", "mount %q: what must be a device, path or remote share", mount.MountPoint))
+		}
+
+		if mount.Type == "" || strings.ContainsAny(mount.Type, " \t\n") {
+			diags = append(diags, invalid(subject("type"), "Invalid mount type", "mount %q: type must be a file system type, e.g. \"ext4\"", mount.MountPoint))
+		}
+
+		if strings.ContainsAny(mount.Options, " \t\n") {
+			diags = append(diags, invalid(subject("options"), "Invalid mount options", "mount %q: options must be a comma-separated list without spaces", mount.MountPoint))
+		}
+
+		if !path.IsAbs(mount.Where) || path.Clean(mount.Where) != mount.Where || mount.Where == "/" || strings.ContainsAny(mount.Where, "\n") {
+			diags = append(diags, invalid(subject("where"), "Invalid mount point", "mount %q: where must be a normalized absolute path other than /", mount.MountPoint))
+		} else if seen[mount.Where] {
+			diags = append(diags, invalid(subject("where"), "Duplicate mount point", "mount %q: %s is mounted more than once", mount.MountPoint, mount.Where))
+		}
+
+		seen[mount.Where] = true
+	}
+
+	return diags
+}
+
+func validateDisks(config *ApplianceConfig) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	partLabels := make(map[string]bool)
+	for _, disk := range config.Disks {
+		if !path.IsAbs(disk.Device) {
+			diags = append(diags, invalid(disk.DefRange.Ptr(), "Invalid disk device", "disk %q: device must be an absolute path, e.g. /dev/sdb", disk.Device))
+		}
+
+		numbers := make(map[int]bool)
+		for _, partition := range disk.Partitions {
+			address := labeledAddress("disk", disk.Device) + "." + labeledAddress("partition", partition.Label)
+			subject := func(attr string) *hcl.Range {
+				return config.sources.attrRange(address, attr, partition.DefRange)
+			}
+
+			if partition.Label == "" || utf8.RuneCountInString(partition.Label) > 36 {
+				diags = append(diags, invalid(partition.DefRange.Ptr(), "Invalid partition label", "disk %q: partition labels must be 1 to 36 characters long", disk.Device))
+			} else if partLabels[partition.Label] {
+				diags = append(diags, invalid(partition.DefRange.Ptr(), "Duplicate partition label", "disk %q: partition %q: another partition has the same label", disk.Device, partition.Label))
+			}
+
+			partLabels[partition.Label] = true
+
+			if partition.Number < 0 {
+				diags = append(diags, invalid(subject("number"), "Invalid partition number", "disk %q: partition %q: number must not be negative", disk.Device, partition.Label))
+			} else if partition.Number > 0 && numbers[partition.Number] {
+				diags = append(diags, invalid(subject("number"), "Duplicate partition number", "disk %q: partition %q: number %d is used more than once", disk.Device, partition.Label, partition.Number))
+			}
+
+			numbers[partition.Number] = true
+
+			if partition.SizeMiB < 0 {
+				diags = append(diags, invalid(subject("size_mib"), "Invalid partition size", "disk %q: partition %q: size_mib must not be negative", disk.Device, partition.Label))
+			}
+
+			if partition.StartMiB < 0 {
+				diags = append(diags, invalid(subject("start_mib"), "Invalid partition start", "disk %q: partition %q: start_mib must not be negative", disk.Device, partition.Label))
+			}
+
+			if partition.TypeGUID != "" && !guidPattern.MatchString(partition.TypeGUID) {
+				diags = append(diags, invalid(subject("type_guid"), "Invalid partition type GUID", "disk %q: partition %q: type_guid must be a GUID", disk.Device, partition.Label))
+			}
+
+			if partition.GUID != "" && !guidPattern.MatchString(partition.GUID) {
+				diags = append(diags, invalid(subject("guid"), "Invalid partition GUID", "disk %q: partition %q: guid must be a GUID", disk.Device, partition.Label))
+			}
+		}
+	}
+
+	return diags
+}
+
+func validateRaids(config *ApplianceConfig) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for _, raid := range config.Raids {
+		address := labeledAddress("raid", raid.Name)
+		subject := func(attr string) *hcl.Range {
+			return config.sources.attrRange(address, attr, raid.DefRange)
+		}
+
+		if raid.Name == "" || strings.ContainsAny(raid.Name, "/ \t\n") {
+			diags = append(diags, invalid(raid.DefRange.Ptr(), "Invalid RAID name", "raid %q: the name must not be empty or contain slashes or spaces", raid.Name))
+		}
+
+		if !slices.Contains(validRaidLevels, raid.Level) {
+			diags = append(diags, invalid(subject("level"), "Invalid RAID level", "raid %q: level must be one of: %s", raid.Name, strings.Join(validRaidLevels, ", ")))
+		} else if len(raid.Devices) < raidMinDevices[raid.Level] {
+			diags = append(diags, invalid(subject("devices"), "Too few RAID devices", "raid %q: a %s array needs at least %d devices", raid.Name, raid.Level, raidMinDevices[raid.Level]))
+		}
+
+		for _, device := range raid.Devices {
+			if !path.IsAbs(device) {
+				diags = append(diags, invalid(subject("devices"), "Invalid RAID device", "raid %q: device %q must be an absolute path", raid.Name, device))
+			}
+		}
+
+		if raid.Spares < 0 {
+			diags = append(diags, invalid(subject("spares"), "Invalid RAID spares", "raid %q: spares must not be negative", raid.Name))
+		}
+	}
+
+	return diags
 }
 
-// func validateMounts(config *ApplianceConfig) error {
-// 	for i, mount := range config.Mounts {
-// 		if mount.Source == "" {
-// 			return fmt.Errorf("mount[%d].source is required", i)
-// 		}
+func validateLuks(config *ApplianceConfig) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for _, luks := range config.Luks {
+		address := labeledAddress("luks", luks.Name)
+		subject := func(attr string) *hcl.Range {
+			return config.sources.attrRange(address, attr, luks.DefRange)
+		}
 
-// 		if mount.Target == "" {
-// 			return fmt.Errorf("mount[%d].target is required", i)
-// 		}
-// 	}
+		if luks.Name == "" || strings.ContainsAny(luks.Name, "/ \t\n") {
+			diags = append(diags, invalid(luks.DefRange.Ptr(), "Invalid LUKS name", "luks %q: the name must not be empty or contain slashes or spaces", luks.Name))
+		}
 
-// 	return nil
-// }
+		if !path.IsAbs(luks.Device) {
+			diags = append(diags, invalid(subject("device"), "Invalid LUKS device", "luks %q: device must be an absolute path, e.g. /dev/disk/by-partlabel/var", luks.Name))
+		}
+
+		// The LUKS2 header holds labels of up to 47 bytes.
+		if len(luks.Label) > 47 {
+			diags = append(diags, invalid(subject("label"), "Invalid LUKS label", "luks %q: label must be at most 47 bytes long", luks.Name))
+		}
+
+		if luks.UUID != "" && !guidPattern.MatchString(luks.UUID) {
+			diags = append(diags, invalid(subject("uuid"), "Invalid LUKS UUID", "luks %q: uuid must be a UUID", luks.Name))
+		}
+
+		if luks.Key != "" && luks.KeyFileURL != "" {
+			diags = append(diags, invalid(subject("key_file_url"), "Conflicting LUKS keys", "luks %q: key and key_file_url are mutually exclusive", luks.Name))
+		}
+
+		if luks.KeyFileURL != "" {
+			if u, err := url.Parse(luks.KeyFileURL); err != nil || u.Scheme == "" {
+				diags = append(diags, invalid(subject("key_file_url"), "Invalid LUKS key URL", "luks %q: key_file_url must be a URL", luks.Name))
+			}
+		}
+
+		if luks.Clevis != nil {
+			diags = append(diags, validateClevis(config, luks, address+".clevis")...)
+		}
+	}
+
+	return diags
+}
+
+func validateClevis(config *ApplianceConfig, luks Luks, address string) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	clevis := luks.Clevis
+	pins := len(clevis.Tang)
+	if clevis.TPM2 {
+		pins++
+	}
+
+	if pins == 0 {
+		diags = append(diags, invalid(clevis.DefRange.Ptr(), "Missing clevis pins", "luks %q: clevis must set tpm2 or have a tang block", luks.Name))
+	}
+
+	if clevis.Threshold < 0 || clevis.Threshold > pins {
+		subject := config.sources.attrRange(address, "threshold", clevis.DefRange)
+		diags = append(diags, invalid(subject, "Invalid clevis threshold", "luks %q: clevis threshold must be between 1 and the number of pins, %d", luks.Name, pins))
+	}
+
+	for _, tang := range clevis.Tang {
+		if u, err := url.Parse(tang.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			diags = append(diags, invalid(tang.DefRange.Ptr(), "Invalid tang URL", "luks %q: tang %q: the URL must be an http or https URL", luks.Name, tang.URL))
+		}
+
+		if tang.Thumbprint == "" {
+			subject := config.sources.attrRange(address+"."+labeledAddress("tang", tang.URL), "thumbprint", tang.DefRange)
+			diags = append(diags, invalid(subject, "Missing tang thumbprint", "luks %q: tang %q: thumbprint is required", luks.Name, tang.URL))
+		}
+	}
+
+	return diags
+}
+
+func validateFilesystems(config *ApplianceConfig) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for _, fs := range config.Filesystems {
+		address := labeledAddress("filesystem", fs.Device)
+		subject := func(attr string) *hcl.Range {
+			return config.sources.attrRange(address, attr, fs.DefRange)
+		}
+
+		if !path.IsAbs(fs.Device) {
+			diags = append(diags, invalid(fs.DefRange.Ptr(), "Invalid filesystem device", "filesystem %q: device must be an absolute path, e.g. /dev/disk/by-partlabel/data", fs.Device))
+		}
+
+		if !slices.Contains(validFilesystemFormats, fs.Format) {
+			diags = append(diags, invalid(subject("format"), "Invalid filesystem format", "filesystem %q: format must be one of: %s", fs.Device, strings.Join(validFilesystemFormats, ", ")))
+		}
+
+		if fs.Path != "" {
+			if fs.Format == "swap" || fs.Format == "none" {
+				diags = append(diags, invalid(subject("path"), "Unmountable filesystem", "filesystem %q: path cannot be set for format %q", fs.Device, fs.Format))
+			} else if !path.IsAbs(fs.Path) || path.Clean(fs.Path) != fs.Path {
+				diags = append(diags, invalid(subject("path"), "Invalid filesystem path", "filesystem %q: path must be a normalized absolute path", fs.Device))
+			}
+		}
+
+		// vfat file systems have a shorter volume ID instead of a UUID.
+		if fs.UUID != "" && fs.Format != "vfat" && !guidPattern.MatchString(fs.UUID) {
+			diags = append(diags, invalid(subject("uuid"), "Invalid filesystem UUID", "filesystem %q: uuid must be a UUID", fs.Device))
+		}
+	}
+
+	return diags
+}
+
+func validateInterfaces(config *ApplianceConfig) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for _, iface := range config.Interfaces {
+		subject := iface.DefRange.Ptr()
 
-func validateInterfaces(config *ApplianceConfig) error {
-	for i, iface := range config.Interfaces {
 		if iface.Name == "" && iface.MACAddress == "" {
-			return fmt.Errorf("interface[%d].name or interface[%d].mac_address is required", i, i)
+			diags = append(diags, invalid(subject, "Missing interface match", "interface.name or interface.mac_address is required"))
 		}
 
 		if iface.MACAddress != "" && iface.Name != "" {
-			return fmt.Errorf("interface[%d].name and interface[%d].mac_address are mutually exclusive", i, i)
+			diags = append(diags, invalid(subject, "Conflicting interface match", "interface.name and interface.mac_address are mutually exclusive"))
 		}
 
 		if (iface.Address != "" || len(iface.Addresses) > 0) && iface.DHCP {
-			return fmt.Errorf("interface[%d].address and interface[%d].dhcp are mutually exclusive", i, i)
+			diags = append(diags, invalid(subject, "Conflicting interface addressing", "interface.address and interface.dhcp are mutually exclusive"))
 		}
 
 		if iface.Address != "" && len(iface.Addresses) > 0 {
-			return fmt.Errorf("interface[%d].address and interface[%d].addresses are mutually exclusive", i, i)
+			diags = append(diags, invalid(subject, "Conflicting interface addresses", "interface.address and interface.addresses are mutually exclusive"))
 		}
 
 		if len(iface.VLANs) == 0 && iface.Address == "" && len(iface.Addresses) == 0 && !iface.DHCP {
-			return fmt.Errorf("interface[%d].address, interface[%d].addresses, or interface[%d].dhcp is required", i, i, i)
+			diags = append(diags, invalid(subject, "Missing interface addressing", "interface.address, interface.addresses, or interface.dhcp is required"))
 		}
 
 		if iface.Address != "" && iface.Gateway == "" {
-			return fmt.Errorf("interface[%d].gateway is required", i)
+			diags = append(diags, invalid(subject, "Missing interface gateway", "interface.gateway is required"))
 		}
 
-		// if iface.Address != "" && iface.DNS == "" {
-		// 	return fmt.Errorf("interface[%d].dns is required", i)
-		// }
+		if (iface.Address != "" || len(iface.Addresses) > 0) && iface.DNS == "" {
+			diags = append(diags, warning(subject, "Missing interface DNS", "interface.dns is not set, so the interface has no DNS server"))
+		}
 
 		seenNames := make(map[string]struct{})
 		seenIDs := make(map[int]struct{})
-		for j, vlan := range iface.VLANs {
-			_, seenName := seenNames[vlan.Name]
-			if seenName {
-				return fmt.Errorf("interface[%d].vlan[%d].name is not unique", i, j)
+		for _, vlan := range iface.VLANs {
+			if _, seenName := seenNames[vlan.Name]; seenName {
+				diags = append(diags, invalid(vlan.DefRange.Ptr(), "Duplicate VLAN name", "vlan %q: name is not unique", vlan.Name))
 			}
 
 			seenNames[vlan.Name] = struct{}{}
 
-			_, seenID := seenIDs[vlan.ID]
-			if seenID {
-				return fmt.Errorf("interface[%d].vlan[%d].id is not unique", i, j)
+			if _, seenID := seenIDs[vlan.ID]; seenID {
+				diags = append(diags, invalid(vlan.DefRange.Ptr(), "Duplicate VLAN ID", "vlan %q: id %d is not unique", vlan.Name, vlan.ID))
 			}
 
 			seenIDs[vlan.ID] = struct{}{}
 
-			if err := validateVLAN(&vlan); err != nil {
-				return fmt.Errorf("interface[%d].vlan[%d]: %w", i, j, err)
-			}
+			diags = append(diags, validateVLAN(&vlan)...)
 		}
 	}
 
-	return nil
+	return diags
 }
 
-func validateVLAN(vlan *VLAN) error {
+func validateVLAN(vlan *VLAN) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
 	if vlan.Address != "" && vlan.DHCP {
-		return fmt.Errorf("vlan.address and vlan.dhcp are mutually exclusive")
+		diags = append(diags, invalid(vlan.DefRange.Ptr(), "Conflicting VLAN addressing", "vlan.address and vlan.dhcp are mutually exclusive"))
 	}
 
 	if vlan.Address == "" && !vlan.DHCP {
-		return fmt.Errorf("vlan.address or vlan.dhcp is required")
+		diags = append(diags, invalid(vlan.DefRange.Ptr(), "Missing VLAN addressing", "vlan.address or vlan.dhcp is required"))
 	}
 
 	if vlan.Address != "" && vlan.Gateway == "" {
-		return fmt.Errorf("vlan.gateway is required")
+		diags = append(diags, invalid(vlan.DefRange.Ptr(), "Missing VLAN gateway", "vlan.gateway is required"))
 	}
 
-	return nil
+	return diags
 }
 
-func validateServices(config *ApplianceConfig) error {
-	for i, service := range config.Services {
+func validateServices(config *ApplianceConfig) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	for _, service := range config.Services {
 		if service.Name == "" {
-			return fmt.Errorf("service[%d].name is required", i)
+			diags = append(diags, invalid(service.DefRange.Ptr(), "Missing service name", "service.name is required"))
 		}
 
 		if service.Inline == "" && service.SourcePath == "" && len(service.DropIns) == 0 && !service.Enabled {
-			return fmt.Errorf("service[%d] must have either inline, source_path, dropins, or be enabled", i)
+			diags = append(diags, invalid(service.DefRange.Ptr(), "Empty service", "service %q must have either inline, source_path, dropins, or be enabled", service.Name))
 		}
 
-		for j, dropin := range service.DropIns {
+		if service.Inline != "" && service.SourcePath != "" {
+			diags = append(diags, warning(service.DefRange.Ptr(), "Multiple service contents", "service %q: inline takes precedence over source_path", service.Name))
+		}
+
+		for _, dropin := range service.DropIns {
 			if dropin.Name == "" {
-				return fmt.Errorf("service[%d].dropin[%d].name is required", i, j)
+				diags = append(diags, invalid(dropin.DefRange.Ptr(), "Missing drop-in name", "service %q: drop_in.name is required", service.Name))
 			}
 
 			if dropin.Inline == "" && dropin.SourcePath == "" {
-				return fmt.Errorf("service[%d].dropin[%d] must have either inline or source_path", i, j)
+				diags = append(diags, invalid(dropin.DefRange.Ptr(), "Empty drop-in", "service %q: drop_in %q must have either inline or source_path", service.Name, dropin.Name))
+			}
+
+			if dropin.Inline != "" && dropin.SourcePath != "" {
+				diags = append(diags, warning(dropin.DefRange.Ptr(), "Multiple drop-in contents", "service %q: drop_in %q: inline takes precedence over source_path", service.Name, dropin.Name))
 			}
 		}
 	}
 
-	return nil
+	return diags
 }
 
-func validateUpdate(config *ApplianceConfig) error {
+func validateUpdate(config *ApplianceConfig) hcl.Diagnostics {
 	if config.System == nil {
 		return nil
 	}
@@ -256,52 +611,135 @@ func validateUpdate(config *ApplianceConfig) error {
 		return nil
 	}
 
+	// The value itself is checked by validateSystem.
 	if config.System.Updates.RebootStrategy == "" {
-		return fmt.Errorf("updates.reboot_strategy is required")
+		return hcl.Diagnostics{invalid(config.System.Updates.DefRange.Ptr(), "Missing reboot strategy", "updates.reboot_strategy is required")}
+	}
+
+	return nil
+}
+
+func validateTimesyncd(config *ApplianceConfig) hcl.Diagnostics {
+	if config.System == nil || config.System.Timesyncd == nil {
+		return nil
 	}
 
-	strat := config.System.Updates.RebootStrategy
-	if strat != "off" && strat != "reboot" && strat != "etcd-lock" {
-		return fmt.Errorf("updates.reboot_strategy must be 'off', 'reboot', or 'etcd-lock'")
+	var diags hcl.Diagnostics
+	timesyncd := config.System.Timesyncd
+	if len(timesyncd.Servers) == 0 && len(timesyncd.FallbackServers) == 0 {
+		diags = append(diags, warning(timesyncd.DefRange.Ptr(), "No NTP servers", "system.timesyncd sets neither servers nor fallback_servers"))
 	}
 
-	return nil
+	checkServers := func(attr string, servers []string) {
+		for _, server := range servers {
+			if server == "" || strings.ContainsAny(server, " \t\n") {
+				subject := config.sources.attrRange("system.timesyncd", attr, timesyncd.DefRange)
+				diags = append(diags, invalid(subject, "Invalid NTP server", "system.timesyncd.%s: %q is not a host name or address", attr, server))
+			}
+		}
+	}
+
+	checkServers("servers", timesyncd.Servers)
+	checkServers("fallback_servers", timesyncd.FallbackServers)
+
+	return diags
 }
 
-func validateEtcd(config *ApplianceConfig) error {
+func validateSwap(config *ApplianceConfig) hcl.Diagnostics {
+	if config.System == nil || config.System.Swap == nil {
+		return nil
+	}
+
+	var diags hcl.Diagnostics
+	swap := config.System.Swap
+	subject := func(attr string) *hcl.Range {
+		return config.sources.attrRange("system.swap", attr, swap.DefRange)
+	}
+
+	// unused reports attributes that do not apply to the type of swap.
+	unused := func(attrs map[string]bool) {
+		for _, attr := range []string{"path", "size_mib", "device", "ram_fraction", "compression_algorithm"} {
+			if attrs[attr] {
+				diags = append(diags, invalid(subject(attr), "Unsupported swap attribute", "system.swap.%s cannot be set for swap of type %q", attr, swap.Type))
+			}
+		}
+	}
+
+	switch swap.Type {
+	case "file":
+		if swap.SizeMiB <= 0 {
+			diags = append(diags, invalid(subject("size_mib"), "Invalid swap size", "system.swap.size_mib must be set to the size of the swap file"))
+		}
+
+		if swap.Path != "" && (!path.IsAbs(swap.Path) || path.Clean(swap.Path) != swap.Path || strings.ContainsAny(swap.Path, " \t\n")) {
+			diags = append(diags, invalid(subject("path"), "Invalid swap file path", "system.swap.path must be a normalized absolute path"))
+		}
+
+		unused(map[string]bool{"device": swap.Device != "", "ram_fraction": swap.RAMFraction != 0, "compression_algorithm": swap.CompressionAlgorithm != ""})
+	case "partition":
+		if !path.IsAbs(swap.Device) {
+			diags = append(diags, invalid(subject("device"), "Invalid swap device", "system.swap.device must be an absolute path, e.g. /dev/disk/by-partlabel/swap"))
+		}
+
+		unused(map[string]bool{"path": swap.Path != "", "size_mib": swap.SizeMiB != 0, "ram_fraction": swap.RAMFraction != 0, "compression_algorithm": swap.CompressionAlgorithm != ""})
+	case "zram":
+		if swap.RAMFraction < 0 {
+			diags = append(diags, invalid(subject("ram_fraction"), "Invalid zram size", "system.swap.ram_fraction must be a positive fraction of the RAM, e.g. 0.5"))
+		}
+
+		if swap.CompressionAlgorithm != "" && !slices.Contains(validZramAlgorithms, swap.CompressionAlgorithm) {
+			diags = append(diags, invalid(subject("compression_algorithm"), "Invalid compression algorithm", "system.swap.compression_algorithm must be one of: %s", strings.Join(validZramAlgorithms, ", ")))
+		}
+
+		unused(map[string]bool{"path": swap.Path != "", "size_mib": swap.SizeMiB != 0, "device": swap.Device != ""})
+	default:
+		diags = append(diags, invalid(subject("type"), "Invalid swap type", "system.swap.type must be one of: %s", strings.Join(validSwapTypes, ", ")))
+	}
+
+	if swap.Priority < 0 || swap.Priority > 32767 {
+		diags = append(diags, invalid(subject("priority"), "Invalid swap priority", "system.swap.priority must be between 0 and 32767"))
+	}
+
+	return diags
+}
+
+func validateEtcd(config *ApplianceConfig) hcl.Diagnostics {
 	if config.Etcd == nil {
 		return nil
 	}
 
+	var diags hcl.Diagnostics
+	subject := config.Etcd.DefRange.Ptr()
+
 	if config.Etcd.Name == "" {
-		return fmt.Errorf("etcd.name is required")
+		diags = append(diags, invalid(subject, "Missing etcd name", "etcd.name is required"))
 	}
 
 	if config.Etcd.InitialToken == "" {
-		return fmt.Errorf("etcd.initial_token is required")
+		diags = append(diags, invalid(subject, "Missing etcd initial token", "etcd.initial_token is required"))
 	}
 
 	if config.Etcd.ListenAddress == "" {
-		return fmt.Errorf("etcd.listen_address is required")
+		diags = append(diags, invalid(subject, "Missing etcd listen address", "etcd.listen_address is required"))
 	}
 
 	if len(config.Etcd.Peers) == 0 {
-		return fmt.Errorf("etcd.peers is required")
+		diags = append(diags, invalid(subject, "Missing etcd peers", "etcd.peers is required"))
 	}
 
-	for i, peer := range config.Etcd.Peers {
+	for _, peer := range config.Etcd.Peers {
 		if peer.Name == "" {
-			return fmt.Errorf("etcd.peer[%d].name is required", i)
+			diags = append(diags, invalid(peer.DefRange.Ptr(), "Missing etcd peer name", "etcd.peer.name is required"))
 		}
 
 		if peer.Address == "" {
-			return fmt.Errorf("etcd.peer[%d].address is required", i)
+			diags = append(diags, invalid(peer.DefRange.Ptr(), "Missing etcd peer address", "etcd peer %q: address is required", peer.Name))
 		}
 
 		if peer.Port == 0 {
-			return fmt.Errorf("etcd.peer[%d].port is required", i)
+			diags = append(diags, invalid(peer.DefRange.Ptr(), "Missing etcd peer port", "etcd peer %q: port is required", peer.Name))
 		}
 	}
 
-	return nil
+	return diags
 }
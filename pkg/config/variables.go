@@ -1,29 +1,31 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/hashicorp/hcl/v2"
-	"github.com/hashicorp/hcl/v2/hcldec"
-	"github.com/hashicorp/hcl/v2/hclsimple"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/rs/zerolog/log"
 	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	"gopkg.in/yaml.v3"
 )
 
-var builtinVariables = map[string]cty.Value{
-	VariableTypeString: cty.StringVal(VariableTypeString),
-	VariableTypeBool:   cty.StringVal(VariableTypeBool),
-	VariableTypeNumber: cty.StringVal(VariableTypeNumber),
-}
+// VariableEnvPrefix is the prefix of environment variables that supply
+// values for variables, e.g. COLA_VAR_hostname.
+const VariableEnvPrefix = "COLA_VAR_"
 
-func buildEvalContext(extraVars map[string]cty.Value) *hcl.EvalContext {
+func buildEvalContext(extraVars map[string]cty.Value, baseDir string) *hcl.EvalContext {
 	variables := make(map[string]cty.Value)
-	for k, v := range builtinVariables {
-		variables[k] = v
-	}
 
 	if extraVars != nil {
 		variables["var"] = cty.ObjectVal(extraVars)
@@ -31,10 +33,19 @@ func buildEvalContext(extraVars map[string]cty.Value) *hcl.EvalContext {
 
 	return &hcl.EvalContext{
 		Variables: variables,
+		Functions: buildFunctions(baseDir),
 	}
 }
 
 func ctyValueToString(v cty.Value) string {
+	if v.IsNull() {
+		return "null"
+	}
+
+	if !v.IsWhollyKnown() {
+		return "<unknown>"
+	}
+
 	switch v.Type() {
 	case cty.String:
 		return v.AsString()
@@ -43,7 +54,11 @@ func ctyValueToString(v cty.Value) string {
 	case cty.Bool:
 		return fmt.Sprintf("%t", v.True())
 	default:
-		return "<unknown>"
+		encoded, err := ctyjson.Marshal(v, v.Type())
+		if err != nil {
+			return "<unknown>"
+		}
+		return string(encoded)
 	}
 }
 
@@ -52,143 +67,678 @@ type VariablePartial struct {
 	Remain    hcl.Body   `hcl:",remain"`
 }
 
-type VariableFile struct {
-	Body hcl.Body `hcl:",remain"`
+// variableSpec holds the decoded declaration of a single variable.
+type variableSpec struct {
+	Name         string
+	Type         cty.Type
+	Defaults     *typeexpr.Defaults
+	Default      cty.Value
+	DefaultRange hcl.Range
+	Sensitive    bool
+	Validations  []VariableValidation
+	Range        hcl.Range
+}
+
+// convert applies any optional object attribute defaults to the value and
+// converts it to the declared type of the variable.
+func (s *variableSpec) convert(v cty.Value) (cty.Value, error) {
+	if s.Defaults != nil {
+		v = s.Defaults.Apply(v)
+	}
+
+	return convert.Convert(v, s.Type)
 }
 
-func readVariableConfig(paths []string) (hcldec.ObjectSpec, map[string]cty.Value, error) {
-	evalCtx := buildEvalContext(nil)
+// displayValue formats a value of the variable for log output.
+func (s *variableSpec) displayValue(v cty.Value) string {
+	if s.Sensitive {
+		return redactedValue
+	}
+
+	return ctyValueToString(v)
+}
 
-	variableSpecs := make(map[string]hcldec.Spec)
-	defaultValues := make(map[string]cty.Value)
+func readVariableConfig(paths []string, files *FileCache) (map[string]*variableSpec, error) {
+	specs := make(map[string]*variableSpec)
 
 	for _, path := range paths {
 		var partial VariablePartial
 
-		err := hclsimple.DecodeFile(path, evalCtx, &partial)
-		if err != nil {
-			return nil, nil, ParseError{Err: err, Path: path}
+		evalCtx := buildEvalContext(nil, filepath.Dir(path))
+
+		file, diags := parseFile(path, files)
+		if diags.HasErrors() {
+			return nil, ParseError{Err: diags, Path: path}
+		}
+
+		diags = gohcl.DecodeBody(file.Body, evalCtx, &partial)
+		if diags.HasErrors() {
+			return nil, ParseError{Err: diags, Path: path}
 		}
 
 		for _, variable := range partial.Variables {
-			if _, ok := variableSpecs[variable.Name]; ok {
-				return nil, nil, fmt.Errorf("variable %q is defined more than once", variable.Name)
+			if _, ok := specs[variable.Name]; ok {
+				return nil, fmt.Errorf("variable %q is defined more than once", variable.Name)
 			}
 
-			var varType cty.Type
-			switch variable.Type {
-			case VariableTypeString:
-				log.Debug().Str("name", variable.Name).Str("type", "string").Msg("Discovered variable")
-				varType = cty.String
-			case VariableTypeNumber:
-				log.Debug().Str("name", variable.Name).Str("type", "number").Msg("Discovered variable")
-				varType = cty.Number
-			case VariableTypeBool:
-				log.Debug().Str("name", variable.Name).Str("type", "boolean").Msg("Discovered variable")
-				varType = cty.Bool
-			default:
-				return nil, nil, fmt.Errorf("unsupported variable type: %s", variable.Type)
+			varType, typeDefaults, diags := typeexpr.TypeConstraintWithDefaults(variable.Type)
+			if diags.HasErrors() {
+				return nil, diags
 			}
 
-			variableSpecs[variable.Name] = &hcldec.AttrSpec{
-				Name:     variable.Name,
-				Type:     varType,
-				Required: false,
-			}
+			log.Debug().Str("name", variable.Name).Str("type", typeexpr.TypeString(varType)).Msg("Discovered variable")
 
-			blockSpec := hcldec.ObjectSpec{
-				"default": &hcldec.AttrSpec{
-					Name:     "default",
-					Type:     varType,
-					Required: false,
-				},
+			spec := &variableSpec{
+				Name:        variable.Name,
+				Type:        varType,
+				Defaults:    typeDefaults,
+				Default:     cty.NullVal(varType),
+				Sensitive:   variable.Sensitive,
+				Validations: variable.Validations,
+				Range:       variable.Type.Range(),
 			}
 
-			val, err := hcldec.Decode(variable.Remain, blockSpec, evalCtx)
-			if err != nil {
-				return nil, nil, err
+			if variable.Default != nil {
+				val, diags := variable.Default.Value(evalCtx)
+				if diags.HasErrors() {
+					return nil, diags
+				}
+
+				if !val.IsNull() {
+					converted, err := spec.convert(val)
+					if err != nil {
+						return nil, hcl.Diagnostics{{
+							Severity: hcl.DiagError,
+							Summary:  "Invalid default value for variable",
+							Detail:   fmt.Sprintf("The default value for variable %q is not compatible with its type: %s.", variable.Name, err),
+							Subject:  variable.Default.Range().Ptr(),
+						}}
+					}
+					spec.Default = converted
+					spec.DefaultRange = variable.Default.Range()
+				}
 			}
 
-			v := val.GetAttr("default")
-			if !v.IsNull() {
-				defaultValues[variable.Name] = v
-			}
+			specs[variable.Name] = spec
 		}
 	}
 
-	return hcldec.ObjectSpec(variableSpecs), defaultValues, nil
+	return specs, nil
 }
 
-func readVariables(paths []string, spec hcldec.ObjectSpec, defaults map[string]cty.Value) (map[string]cty.Value, error) {
+// valueExpr evaluates an expression supplying a value for the variable and
+// converts the result to the declared type.
+func (s *variableSpec) valueExpr(expr hcl.Expression, evalCtx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	raw, diags := expr.Value(evalCtx)
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+
+	if raw.IsNull() {
+		return raw, nil
+	}
+
+	v, err := s.convert(raw)
+	if err != nil {
+		diag := &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid value for variable",
+			Detail:   fmt.Sprintf("The value for variable %q is not compatible with its type %s: %s.", s.Name, typeexpr.TypeString(s.Type), err),
+			Subject:  expr.Range().Ptr(),
+		}
+
+		if s.Sensitive {
+			diag.Extra = sensitiveSubject{}
+		}
+
+		return cty.NilVal, hcl.Diagnostics{diag}
+	}
+
+	return v, nil
+}
+
+// rawValueExpr builds an expression for a value given as a plain string on
+// the command line or in the environment. Values for string variables are
+// taken literally, all others are parsed as HCL expressions.
+func (s *variableSpec) rawValueExpr(raw, source string) (hcl.Expression, hcl.Diagnostics) {
+	if s.Type == cty.String || s.Type == cty.DynamicPseudoType {
+		rng := hcl.Range{
+			Filename: source,
+			Start:    hcl.InitialPos,
+			End:      hcl.Pos{Line: 1, Column: len(raw) + 1, Byte: len(raw)},
+		}
+		return hcl.StaticExpr(cty.StringVal(raw), rng), nil
+	}
+
+	return hclsyntax.ParseExpression([]byte(raw), source, hcl.InitialPos)
+}
+
+// readEnvVariables collects values from COLA_VAR_<name> environment variables.
+// Variables that are not declared are ignored.
+func readEnvVariables(environ []string, specs map[string]*variableSpec) (map[string]cty.Value, map[string]hcl.Range, error) {
 	variables := make(map[string]cty.Value)
-	for _, valuePath := range paths {
-		data, err := os.ReadFile(valuePath)
+	sources := make(map[string]hcl.Range)
+
+	for _, env := range environ {
+		key, raw, ok := strings.Cut(env, "=")
+		if !ok || !strings.HasPrefix(key, VariableEnvPrefix) {
+			continue
+		}
+
+		name := strings.TrimPrefix(key, VariableEnvPrefix)
+		spec, ok := specs[name]
+		if !ok {
+			log.Debug().Str("name", name).Str("env", key).Msg("Ignoring environment variable for undeclared variable")
+			continue
+		}
+
+		expr, diags := spec.rawValueExpr(raw, key)
+		if diags.HasErrors() {
+			return nil, nil, diags
+		}
+
+		v, diags := spec.valueExpr(expr, nil)
+		if diags.HasErrors() {
+			return nil, nil, diags
+		}
+
+		if v.IsNull() {
+			continue
+		}
+
+		log.Debug().
+			Str("name", name).
+			Str("value", spec.displayValue(v)).
+			Str("env", key).
+			Msg("Loaded value for variable")
+
+		variables[name] = v
+		sources[name] = expr.Range()
+	}
+
+	return variables, sources, nil
+}
+
+// readFlagVariables collects values given with --var name=value.
+func readFlagVariables(values map[string]string, specs map[string]*variableSpec) (map[string]cty.Value, map[string]hcl.Range, error) {
+	variables := make(map[string]cty.Value)
+	sources := make(map[string]hcl.Range)
+
+	for name, raw := range values {
+		spec, ok := specs[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("a value was given for variable %q, but no variable of that name is declared", name)
+		}
+
+		expr, diags := spec.rawValueExpr(raw, "--var "+name)
+		if diags.HasErrors() {
+			return nil, nil, diags
+		}
+
+		v, diags := spec.valueExpr(expr, nil)
+		if diags.HasErrors() {
+			return nil, nil, diags
+		}
+
+		if v.IsNull() {
+			continue
+		}
+
+		log.Debug().
+			Str("name", name).
+			Str("value", spec.displayValue(v)).
+			Str("flag", "--var").
+			Msg("Loaded value for variable")
+
+		variables[name] = v
+		sources[name] = expr.Range()
+	}
+
+	return variables, sources, nil
+}
+
+// readValueFile reads the attributes of a value file. YAML files are read
+// as a mapping of variable names to values, all other files as HCL in native
+// or JSON syntax. Encrypted files are decrypted first.
+func readValueFile(path string, dec *decrypter, files *FileCache) (hcl.Attributes, hcl.Diagnostics) {
+	name, encrypted := strings.CutSuffix(path, encryptedExtension)
+	if !encrypted && !hasExtension(name, yamlExtensions) {
+		file, diags := parseFile(path, files)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		return file.Body.JustAttributes()
+	}
+
+	var data []byte
+	if encrypted {
+		var diags hcl.Diagnostics
+		data, diags = dec.decryptFile(path)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+	} else {
+		var err error
+		data, err = os.ReadFile(path)
 		if err != nil {
-			return nil, err
+			return nil, hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to read file",
+				Detail:   fmt.Sprintf("The file %q could not be read: %s.", path, err),
+			}}
+		}
+	}
+
+	if hasExtension(name, yamlExtensions) {
+		return readYAMLValues(path, data)
+	}
+
+	file, diags := parseSource(data, path)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	return file.Body.JustAttributes()
+}
+
+// readYAMLValues reads the contents of a YAML value file. Each value is
+// decoded as JSON would be, and converted to the type of its variable later
+// on.
+func readYAMLValues(path string, data []byte) (hcl.Attributes, hcl.Diagnostics) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid YAML",
+			Detail:   err.Error(),
+			Subject:  &hcl.Range{Filename: path, Start: hcl.InitialPos, End: hcl.InitialPos},
+		}}
+	}
+
+	attrs := make(hcl.Attributes)
+	if len(doc.Content) == 0 {
+		return attrs, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid value file",
+			Detail:   "A YAML value file must be a mapping of variable names to values.",
+			Subject:  yamlRange(path, data, root).Ptr(),
+		}}
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, node := root.Content[i], root.Content[i+1]
+		nameRange, valueRange := yamlRange(path, data, key), yamlRange(path, data, node)
+
+		var value any
+		if err := node.Decode(&value); err != nil {
+			return nil, hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid YAML value",
+				Detail:   err.Error(),
+				Subject:  valueRange.Ptr(),
+			}}
 		}
 
-		var value VariableFile
-		err = hclsimple.Decode("variable.hcl", data, nil, &value)
+		val, err := yamlToCty(value)
 		if err != nil {
-			return nil, ParseError{Err: err, Path: valuePath}
+			return nil, hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid YAML value",
+				Detail:   fmt.Sprintf("The value of %q cannot be used as a variable value: %s.", key.Value, err),
+				Subject:  valueRange.Ptr(),
+			}}
+		}
+
+		attrs[key.Value] = &hcl.Attribute{
+			Name:      key.Value,
+			Expr:      hcl.StaticExpr(val, valueRange),
+			Range:     hcl.RangeBetween(nameRange, valueRange),
+			NameRange: nameRange,
 		}
+	}
+
+	return attrs, nil
+}
+
+// yamlRange returns the range from a YAML node to the end of its line.
+func yamlRange(path string, data []byte, node *yaml.Node) hcl.Range {
+	offset := 0
+	for line := 1; line < node.Line && offset < len(data); line++ {
+		next := bytes.IndexByte(data[offset:], '\n')
+		if next < 0 {
+			offset = len(data)
+			break
+		}
+		offset += next + 1
+	}
+
+	start := min(offset+node.Column-1, len(data))
+	end := len(data)
+	if next := bytes.IndexByte(data[start:], '\n'); next >= 0 {
+		end = start + next
+	}
+
+	return hcl.Range{
+		Filename: path,
+		Start:    hcl.Pos{Line: node.Line, Column: node.Column, Byte: start},
+		End:      hcl.Pos{Line: node.Line, Column: node.Column + end - start, Byte: end},
+	}
+}
+
+// yamlToCty converts a decoded YAML value by way of its JSON encoding.
+func yamlToCty(value any) (cty.Value, error) {
+	if value == nil {
+		return cty.NullVal(cty.DynamicPseudoType), nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return cty.NilVal, err
+	}
 
-		val, diags := hcldec.Decode(value.Body, spec, nil)
+	ty, err := ctyjson.ImpliedType(data)
+	if err != nil {
+		return cty.NilVal, err
+	}
+
+	return ctyjson.Unmarshal(data, ty)
+}
+
+// readFileVariables reads the values set in value files, followed by the
+// values in extra. They are applied in order, so a value set later replaces
+// one set earlier.
+func readFileVariables(paths []string, extra []hcl.Attributes, specs map[string]*variableSpec, dec *decrypter, files *FileCache) (map[string]cty.Value, map[string]hcl.Range, error) {
+	sets := make([]hcl.Attributes, 0, len(paths)+len(extra))
+	for _, valuePath := range paths {
+		attrs, diags := readValueFile(valuePath, dec, files)
 		if diags.HasErrors() {
-			return nil, diags
+			return nil, nil, ParseError{Err: diags, Path: valuePath}
 		}
 
-		for k, v := range val.AsValueMap() {
+		sets = append(sets, attrs)
+	}
+
+	sets = append(sets, extra...)
+
+	variables := make(map[string]cty.Value)
+	sources := make(map[string]hcl.Range)
+	for _, attrs := range sets {
+		for k, attr := range attrs {
+			spec, ok := specs[k]
+			if !ok {
+				return nil, nil, hcl.Diagnostics{{
+					Severity: hcl.DiagError,
+					Summary:  "Undeclared variable",
+					Detail:   fmt.Sprintf("A value was given for variable %q, but no variable of that name is declared.", k),
+					Subject:  attr.NameRange.Ptr(),
+				}}
+			}
+
+			// Values of encrypted files, and encrypted values, are treated as
+			// sensitive. The latter are read as if given with --var.
+			expr := attr.Expr
+			encrypted := strings.HasSuffix(attr.NameRange.Filename, encryptedExtension)
+
+			plaintext, encryptedValue, diags := dec.decryptExpr(expr)
+			if diags.HasErrors() {
+				return nil, nil, diags
+			}
+
+			if encryptedValue {
+				encrypted = true
+				expr, diags = spec.rawValueExpr(plaintext, fmt.Sprintf("decrypted value of %s", attr.Expr.Range()))
+				if diags.HasErrors() {
+					return nil, nil, diags
+				}
+			}
+
+			v, diags := spec.valueExpr(expr, nil)
+			if diags.HasErrors() {
+				return nil, nil, diags
+			}
+
 			if v.IsNull() {
 				continue
 			}
 
+			value := spec.displayValue(v)
+			if encrypted {
+				dec.decrypted[k] = true
+				value = redactedValue
+			}
+
 			log.Debug().
 				Str("name", k).
-				Str("value", ctyValueToString(v)).
-				Str("file", filepath.Base(valuePath)).
+				Str("value", value).
+				Str("file", filepath.Base(attr.NameRange.Filename)).
 				Msg("Loaded value for variable")
 
-			_, ok := variables[k]
-			if ok {
-				return nil, fmt.Errorf("variable %s already defined", k)
-			}
+			variables[k] = v
+			sources[k] = attr.Expr.Range()
+		}
+	}
+
+	return variables, sources, nil
+}
+
+// readVariables resolves the value of every declared variable. Later sources
+// take precedence over earlier ones:
+//
+//  1. the default value from the variable block
+//  2. COLA_VAR_<name> environment variables
+//  3. value files, in the order given, then values set with WithValues
+//  4. --var name=value flags
+func readVariables(paths []string, specs map[string]*variableSpec, opts *readOptions, dec *decrypter) (map[string]cty.Value, map[string]hcl.Range, error) {
+	variables := make(map[string]cty.Value)
+	sources := make(map[string]hcl.Range)
+	fromFile := make(map[string]bool)
+
+	readers := []struct {
+		file bool
+		read func() (map[string]cty.Value, map[string]hcl.Range, error)
+	}{
+		{read: func() (map[string]cty.Value, map[string]hcl.Range, error) {
+			return readEnvVariables(opts.Environ, specs)
+		}},
+		{file: true, read: func() (map[string]cty.Value, map[string]hcl.Range, error) {
+			return readFileVariables(paths, opts.Values, specs, dec, opts.Files)
+		}},
+		{read: func() (map[string]cty.Value, map[string]hcl.Range, error) {
+			return readFlagVariables(opts.Variables, specs)
+		}},
+	}
 
+	for _, reader := range readers {
+		values, valueSources, err := reader.read()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for k, v := range values {
 			variables[k] = v
+			sources[k] = valueSources[k]
+			fromFile[k] = reader.file
 		}
 	}
 
+	// Only report the file a value came from once it is known that no
+	// later source overrides it.
+	names := make([]string, 0, len(fromFile))
+	for name, file := range fromFile {
+		if file {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		log.Debug().
+			Str("name", name).
+			Str("file", sources[name].Filename).
+			Msg("Using value for variable from file")
+	}
+
+	if err := applyDefaults(specs, variables, sources); err != nil {
+		return nil, nil, err
+	}
+
+	return variables, sources, nil
+}
+
+// applyDefaults fills in the default value of every variable that was not
+// given a value, and fails if a variable without a default is left unset.
+func applyDefaults(specs map[string]*variableSpec, variables map[string]cty.Value, sources map[string]hcl.Range) error {
 	missing := make([]string, 0)
-	for k := range spec {
+	for k, spec := range specs {
 		_, ok := variables[k]
 		if !ok {
-			defaultVal, ok := defaults[k]
-			if !ok {
+			if spec.Default.IsNull() {
 				missing = append(missing, k)
 				continue
 			}
 
-			variables[k] = defaultVal
+			variables[k] = spec.Default
+			sources[k] = spec.DefaultRange
 			log.Debug().
 				Str("name", k).
-				Str("value", ctyValueToString(defaultVal)).
+				Str("value", spec.displayValue(spec.Default)).
 				Msg("Using default value for variable")
 
 		}
 	}
 
 	if len(missing) > 0 {
-		return nil, fmt.Errorf("missing values for required variables: %s", strings.Join(missing, ", "))
+		slices.Sort(missing)
+		return fmt.Errorf("missing values for required variables: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// validateVariables evaluates the validation rules of every variable against
+// its resolved value. All failing rules are reported, pointing at the place
+// the value was set. The snippet of that place is hidden for sensitive
+// variables.
+func validateVariables(specs map[string]*variableSpec, variables map[string]cty.Value, sources map[string]hcl.Range, sensitive map[string]bool) hcl.Diagnostics {
+	sensitiveValues := collectSensitive(variables, sensitive)
+
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var diags hcl.Diagnostics
+	for _, name := range names {
+		spec := specs[name]
+		source := sources[name]
+		evalCtx := buildEvalContext(variables, filepath.Dir(spec.Range.Filename))
+
+		for _, validation := range spec.Validations {
+			result, condDiags := validation.Condition.Value(evalCtx)
+			diags = append(diags, condDiags...)
+			if condDiags.HasErrors() {
+				continue
+			}
+
+			if result.IsNull() || !result.IsKnown() {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid validation result",
+					Detail:   fmt.Sprintf("The condition for variable %q must return either true or false.", name),
+					Subject:  validation.Condition.Range().Ptr(),
+				})
+				continue
+			}
+
+			result, err := convert.Convert(result, cty.Bool)
+			if err != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid validation result",
+					Detail:   fmt.Sprintf("The condition for variable %q must return a boolean: %s.", name, err),
+					Subject:  validation.Condition.Range().Ptr(),
+				})
+				continue
+			}
+
+			if result.True() {
+				continue
+			}
+
+			message := fmt.Sprintf("The value for variable %q is invalid.", name)
+			msgVal, msgDiags := validation.ErrorMessage.Value(evalCtx)
+			diags = append(diags, msgDiags...)
+			if !msgDiags.HasErrors() {
+				msgVal, err = convert.Convert(msgVal, cty.String)
+				if err == nil && !msgVal.IsNull() && msgVal.IsKnown() {
+					message = redactString(msgVal.AsString(), sensitiveValues)
+				}
+			}
+
+			diag := &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid value for variable",
+				Detail:   fmt.Sprintf("%s (checked by the validation rule at %s)", message, validation.Condition.Range()),
+				Subject:  validation.Condition.Range().Ptr(),
+			}
+
+			if source != (hcl.Range{}) {
+				diag.Subject = source.Ptr()
+				if sensitive[name] {
+					diag.Extra = sensitiveSubject{}
+				}
+			}
+
+			diags = append(diags, diag)
+		}
 	}
 
-	return variables, nil
+	return diags
 }
 
-func loadVariables(configPaths, valuePaths []string) (map[string]cty.Value, error) {
-	variableSpec, defaultValues, err := readVariableConfig(configPaths)
+// loadVariables resolves and validates the values of all declared variables.
+// It also returns the names of the variables marked as sensitive, or given an
+// encrypted value.
+func loadVariables(configPaths, valuePaths []string, opts *readOptions) (map[string]cty.Value, map[string]bool, error) {
+	specs, err := readVariableConfig(configPaths, opts.Files)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	dec := newDecrypter(opts.KeyFiles)
+	variables, sources, err := readVariables(valuePaths, specs, opts, dec)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sensitive, err := checkVariables(specs, variables, sources, dec.decrypted)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return variables, sensitive, nil
+}
+
+// checkVariables validates resolved variable values and returns the names of
+// the sensitive variables, including any in extraSensitive.
+func checkVariables(specs map[string]*variableSpec, variables map[string]cty.Value, sources map[string]hcl.Range, extraSensitive map[string]bool) (map[string]bool, error) {
+	sensitive := make(map[string]bool)
+	for name, spec := range specs {
+		if spec.Sensitive || extraSensitive[name] {
+			sensitive[name] = true
+		}
+	}
+
+	if diags := validateVariables(specs, variables, sources, sensitive); diags.HasErrors() {
+		return nil, diags
 	}
 
-	return readVariables(valuePaths, variableSpec, defaultValues)
+	return sensitive, nil
 }
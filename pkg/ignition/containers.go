@@ -68,7 +68,16 @@ func generateContainers(cfg *config.ApplianceConfig, g *generator) error {
 	}
 
 	for _, container := range cfg.Containers {
-		contents, err := templates.SystemdContainer(container)
+		// Volumes on mounted file systems are only available once the
+		// file system is mounted.
+		var requiresMountsFor []string
+		for _, volume := range container.Volumes {
+			if onMount(cfg, volume.Source) {
+				requiresMountsFor = append(requiresMountsFor, volume.Source)
+			}
+		}
+
+		contents, err := templates.SystemdContainer(container, requiresMountsFor...)
 		if err != nil {
 			return fmt.Errorf("failed to format container unit contents: %v", err)
 		}
@@ -0,0 +1,103 @@
+package ignition
+
+import (
+	ignitionTypes "github.com/coreos/ignition/v2/config/v3_4/types"
+	"github.com/tmacro/cola/pkg/config"
+)
+
+func generateDisks(cfg *config.ApplianceConfig, g *generator) error {
+	for _, disk := range cfg.Disks {
+		ignDisk := ignitionTypes.Disk{
+			Device:    disk.Device,
+			WipeTable: toOptPtr(disk.WipeTable),
+		}
+
+		for _, partition := range disk.Partitions {
+			ignDisk.Partitions = append(ignDisk.Partitions, ignitionTypes.Partition{
+				Label:              toPtr(partition.Label),
+				Number:             partition.Number,
+				SizeMiB:            toOptPtr(partition.SizeMiB),
+				StartMiB:           toOptPtr(partition.StartMiB),
+				TypeGUID:           toOptPtr(partition.TypeGUID),
+				GUID:               toOptPtr(partition.GUID),
+				WipePartitionEntry: toOptPtr(partition.WipePartitionEntry),
+				Resize:             toOptPtr(partition.Resize),
+			})
+		}
+
+		g.Disks = append(g.Disks, ignDisk)
+	}
+
+	return nil
+}
+
+func generateRaids(cfg *config.ApplianceConfig, g *generator) error {
+	for _, raid := range cfg.Raids {
+		ignRaid := ignitionTypes.Raid{
+			Name:   raid.Name,
+			Level:  toPtr(raid.Level),
+			Spares: toOptPtr(raid.Spares),
+		}
+
+		for _, device := range raid.Devices {
+			ignRaid.Devices = append(ignRaid.Devices, ignitionTypes.Device(device))
+		}
+
+		for _, option := range raid.Options {
+			ignRaid.Options = append(ignRaid.Options, ignitionTypes.RaidOption(option))
+		}
+
+		g.Raids = append(g.Raids, ignRaid)
+	}
+
+	return nil
+}
+
+func generateFilesystems(cfg *config.ApplianceConfig, g *generator) error {
+	for _, fs := range cfg.Filesystems {
+		ignFs := ignitionTypes.Filesystem{
+			Device:         fs.Device,
+			Format:         toPtr(fs.Format),
+			Label:          toOptPtr(fs.Label),
+			UUID:           toOptPtr(fs.UUID),
+			Path:           toOptPtr(fs.Path),
+			WipeFilesystem: toOptPtr(fs.WipeFilesystem),
+		}
+
+		for _, option := range fs.Options {
+			ignFs.Options = append(ignFs.Options, ignitionTypes.FilesystemOption(option))
+		}
+
+		for _, option := range fs.MountOptions {
+			ignFs.MountOptions = append(ignFs.MountOptions, ignitionTypes.MountOption(option))
+		}
+
+		g.Filesystems = append(g.Filesystems, ignFs)
+	}
+
+	return nil
+}
+
+func validateDisks(g *generator) error {
+	if !keysAreUnique(g.Disks, func(d ignitionTypes.Disk) string { return d.Device }) {
+		return ErrDuplicateDisk
+	}
+
+	return nil
+}
+
+func validateRaids(g *generator) error {
+	if !keysAreUnique(g.Raids, func(r ignitionTypes.Raid) string { return r.Name }) {
+		return ErrDuplicateRaid
+	}
+
+	return nil
+}
+
+func validateFilesystems(g *generator) error {
+	if !keysAreUnique(g.Filesystems, func(f ignitionTypes.Filesystem) string { return f.Device }) {
+		return ErrDuplicateFilesystem
+	}
+
+	return nil
+}
@@ -9,12 +9,16 @@ import (
 )
 
 var (
-	ErrDuplicateFile      = errors.New("duplicate file")
-	ErrDuplicateDirectory = errors.New("duplicate directory")
-	ErrDuplicateUnit      = errors.New("duplicate unit")
-	ErrDuplicateDropin    = errors.New("duplicate dropin")
-	ErrDuplicateUser      = errors.New("duplicate user")
-	ErrDuplicateSymlink   = errors.New("duplicate symlink")
+	ErrDuplicateFile       = errors.New("duplicate file")
+	ErrDuplicateDirectory  = errors.New("duplicate directory")
+	ErrDuplicateUnit       = errors.New("duplicate unit")
+	ErrDuplicateDropin     = errors.New("duplicate dropin")
+	ErrDuplicateUser       = errors.New("duplicate user")
+	ErrDuplicateSymlink    = errors.New("duplicate symlink")
+	ErrDuplicateDisk       = errors.New("duplicate disk")
+	ErrDuplicateRaid       = errors.New("duplicate raid")
+	ErrDuplicateLuks       = errors.New("duplicate luks volume")
+	ErrDuplicateFilesystem = errors.New("duplicate filesystem")
 )
 
 type GeneratorOpt func(*generator)
@@ -59,6 +63,10 @@ type generator struct {
 	Links             []ignitionTypes.Link
 	Directories       []ignitionTypes.Directory
 	Units             []ignitionTypes.Unit
+	Disks             []ignitionTypes.Disk
+	Raids             []ignitionTypes.Raid
+	Luks              []ignitionTypes.Luks
+	Filesystems       []ignitionTypes.Filesystem
 }
 
 func newGenerator() *generator {
@@ -85,6 +93,10 @@ func (g *generator) Ignition(cfg *config.ApplianceConfig) (*ignitionTypes.Config
 	ignCfg.Storage.Files = g.Files
 	ignCfg.Storage.Directories = g.Directories
 	ignCfg.Storage.Links = g.Links
+	ignCfg.Storage.Disks = g.Disks
+	ignCfg.Storage.Raid = g.Raids
+	ignCfg.Storage.Luks = g.Luks
+	ignCfg.Storage.Filesystems = g.Filesystems
 	ignCfg.Systemd.Units = g.Units
 
 	return &ignCfg, nil
@@ -99,8 +111,16 @@ func (g *generator) generate(cfg *config.ApplianceConfig) error {
 		generateFiles,
 		generateDirectories,
 		generateSymlinks,
+		generateDisks,
+		generateRaids,
+		generateLuks,
+		generateFilesystems,
+		generateMounts,
 		generateKernelArguments,
 		generateHostname,
+		generateTimezone,
+		generateTimesyncdConfig,
+		generateSwap,
 		generateServices,
 		generateEtcdConfig,
 		generateUpdateConfig,
@@ -124,6 +144,10 @@ func (g *generator) validate() error {
 		validateDirectories,
 		validateUnits,
 		validateSymlinks,
+		validateDisks,
+		validateRaids,
+		validateLuks,
+		validateFilesystems,
 	}
 
 	for _, validator := range validators {
@@ -142,3 +166,14 @@ type ignitionValidator func(*generator) error
 func toPtr[T any](v T) *T {
 	return &v
 }
+
+// toOptPtr is like toPtr, but returns nil for the zero value so that unset
+// attributes are left out of the Ignition config.
+func toOptPtr[T comparable](v T) *T {
+	var zero T
+	if v == zero {
+		return nil
+	}
+
+	return &v
+}
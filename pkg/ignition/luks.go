@@ -0,0 +1,87 @@
+package ignition
+
+import (
+	"slices"
+
+	ignitionTypes "github.com/coreos/ignition/v2/config/v3_4/types"
+	"github.com/tmacro/cola/pkg/config"
+)
+
+// luksDevicePrefix is where opened LUKS volumes are mapped, e.g.
+// /dev/mapper/var for the volume named var.
+const luksDevicePrefix = "/dev/mapper/"
+
+func generateLuks(cfg *config.ApplianceConfig, g *generator) error {
+	for _, luks := range cfg.Luks {
+		ignLuks := ignitionTypes.Luks{
+			Name:       luks.Name,
+			Device:     toPtr(luks.Device),
+			Label:      toOptPtr(luks.Label),
+			UUID:       toOptPtr(luks.UUID),
+			WipeVolume: toOptPtr(luks.WipeVolume),
+			Discard:    toOptPtr(luks.Discard),
+		}
+
+		if luks.Key != "" {
+			ignLuks.KeyFile.Source = toPtr(toDataUrl(luks.Key))
+		} else if luks.KeyFileURL != "" {
+			ignLuks.KeyFile.Source = toPtr(luks.KeyFileURL)
+		}
+
+		for _, option := range luks.Options {
+			ignLuks.Options = append(ignLuks.Options, ignitionTypes.LuksOption(option))
+		}
+
+		for _, option := range luks.OpenOptions {
+			ignLuks.OpenOptions = append(ignLuks.OpenOptions, ignitionTypes.OpenOption(option))
+		}
+
+		if clevis := luks.Clevis; clevis != nil {
+			ignLuks.Clevis.Tpm2 = toOptPtr(clevis.TPM2)
+			ignLuks.Clevis.Threshold = toOptPtr(clevis.Threshold)
+			for _, tang := range clevis.Tang {
+				ignLuks.Clevis.Tang = append(ignLuks.Clevis.Tang, ignitionTypes.Tang{
+					URL:           tang.URL,
+					Thumbprint:    toPtr(tang.Thumbprint),
+					Advertisement: toOptPtr(tang.Advertisement),
+				})
+			}
+		}
+
+		g.Luks = append(g.Luks, ignLuks)
+	}
+
+	return nil
+}
+
+// needsNetwork reports whether device is a LUKS volume unlocked through a
+// tang server, or a file system on one, and so is only available once the
+// network is online.
+func needsNetwork(cfg *config.ApplianceConfig, device string) bool {
+	for _, luks := range cfg.Luks {
+		if luks.Clevis == nil || len(luks.Clevis.Tang) == 0 {
+			continue
+		}
+
+		paths := []string{luksDevicePrefix + luks.Name, "/dev/disk/by-id/dm-name-" + luks.Name}
+		for _, fs := range cfg.Filesystems {
+			if fs.Label != "" && slices.Contains(paths, fs.Device) {
+				paths = append(paths, "/dev/disk/by-label/"+fs.Label)
+			}
+		}
+
+		if slices.Contains(paths, device) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validateLuks(g *generator) error {
+	if !keysAreUnique(g.Luks, func(l ignitionTypes.Luks) string { return l.Name }) {
+		return ErrDuplicateLuks
+	}
+
+	return nil
+}
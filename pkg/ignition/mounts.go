@@ -2,6 +2,8 @@ package ignition
 
 import (
 	"fmt"
+	"path"
+	"slices"
 	"strings"
 
 	ignitionTypes "github.com/coreos/ignition/v2/config/v3_4/types"
@@ -9,28 +11,86 @@ import (
 	"github.com/tmacro/cola/pkg/config"
 )
 
+// networkFileSystems are the file system types mounted over the network.
+var networkFileSystems = []string{"nfs", "nfs4", "cifs", "smb3", "smbfs", "ceph", "glusterfs", "sshfs", "fuse.sshfs", "davfs"}
+
+// isNetworkMount reports whether a mount needs the network, either because of
+// its type, because it is marked with the _netdev option, or because it
+// mounts a LUKS volume unlocked through a tang server.
+func isNetworkMount(cfg *config.ApplianceConfig, mount config.Mount) bool {
+	return slices.Contains(networkFileSystems, mount.Type) ||
+		slices.Contains(strings.Split(mount.Options, ","), "_netdev") ||
+		needsNetwork(cfg, mount.What)
+}
+
+// escapeUnitPath escapes a path for use as a unit name, like
+// systemd-escape --path.
+func escapeUnitPath(p string) string {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if p == "" {
+		return "-"
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case c == '/':
+			b.WriteByte('-')
+		case c == '.' && i == 0:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == ':', c == '_', c == '.':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		}
+	}
+
+	return b.String()
+}
+
+// onMount reports whether path is on a file system mounted by a mount block.
+func onMount(cfg *config.ApplianceConfig, p string) bool {
+	for _, mount := range cfg.Mounts {
+		if p == mount.Where || strings.HasPrefix(p, mount.Where+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
 func generateMounts(cfg *config.ApplianceConfig, g *generator) error {
 	for _, mount := range cfg.Mounts {
-		contents, err := templates.SystemdMount(mount)
+		network := isNetworkMount(cfg, mount)
+		unitName := escapeUnitPath(mount.Where)
+
+		contents, err := templates.SystemdMount(mount, network)
 		if err != nil {
 			return fmt.Errorf("failed to format systemd mount contents: %v", err)
 		}
 
-		mountName := strings.TrimPrefix(mount.Where, "/")
-		mountName = strings.ReplaceAll(mountName, "/", "-")
-
-		g.Files = append(g.Files, ignitionTypes.File{
-			Node: ignitionTypes.Node{
-				Path: fmt.Sprintf("/etc/systemd/system/%s.mount", mountName),
-			},
-			FileEmbedded1: ignitionTypes.FileEmbedded1{
-				Mode: toPtr(0644),
-				Contents: ignitionTypes.Resource{
-					Source: toPtr(toDataUrl(contents)),
-				},
-			},
-		})
+		unit := ignitionTypes.Unit{
+			Name:     unitName + ".mount",
+			Contents: toPtr(contents),
+		}
 
+		if !mount.Automount {
+			unit.Enabled = toPtr(true)
+			g.Units = append(g.Units, unit)
+			continue
+		}
+
+		automount, err := templates.SystemdAutomount(mount, network)
+		if err != nil {
+			return fmt.Errorf("failed to format systemd automount contents: %v", err)
+		}
+
+		g.Units = append(g.Units, unit, ignitionTypes.Unit{
+			Name:     unitName + ".automount",
+			Enabled:  toPtr(true),
+			Contents: toPtr(automount),
+		})
 	}
 
 	return nil
@@ -0,0 +1,116 @@
+package ignition
+
+import (
+	"fmt"
+
+	ignitionTypes "github.com/coreos/ignition/v2/config/v3_4/types"
+	"github.com/tmacro/cola/internal/templates"
+	"github.com/tmacro/cola/pkg/config"
+)
+
+const (
+	defaultSwapfilePath = "/var/swapfile"
+	swapfileService     = "create-swapfile.service"
+	// defaultZramFraction is the fraction of RAM used for zram, unless set.
+	defaultZramFraction = 0.5
+)
+
+func generateSwap(cfg *config.ApplianceConfig, g *generator) error {
+	swap := cfg.System.Swap
+	if swap == nil {
+		return nil
+	}
+
+	switch swap.Type {
+	case "file":
+		return generateSwapfile(swap, g)
+	case "partition":
+		return generateSwapPartition(cfg, swap, g)
+	case "zram":
+		return generateZram(swap, g)
+	default:
+		return fmt.Errorf("unknown swap type %q", swap.Type)
+	}
+}
+
+func generateSwapfile(swap *config.Swap, g *generator) error {
+	path := swap.Path
+	if path == "" {
+		path = defaultSwapfilePath
+	}
+
+	service, err := templates.SwapfileService(path, swap.SizeMiB)
+	if err != nil {
+		return fmt.Errorf("failed to format swap file service contents: %v", err)
+	}
+
+	g.Units = append(g.Units, ignitionTypes.Unit{
+		Name:     swapfileService,
+		Contents: toPtr(service),
+	})
+
+	return appendSwapUnit(g, path, swap.Priority, swapfileService)
+}
+
+func generateSwapPartition(cfg *config.ApplianceConfig, swap *config.Swap, g *generator) error {
+	// The partition is formatted by Ignition, unless a filesystem block
+	// already takes care of the device.
+	formatted := false
+	for _, fs := range cfg.Filesystems {
+		if fs.Device == swap.Device {
+			formatted = true
+			break
+		}
+	}
+
+	if !formatted {
+		g.Filesystems = append(g.Filesystems, ignitionTypes.Filesystem{
+			Device: swap.Device,
+			Format: toPtr("swap"),
+		})
+	}
+
+	return appendSwapUnit(g, swap.Device, swap.Priority, "")
+}
+
+func appendSwapUnit(g *generator, what string, priority int, service string) error {
+	contents, err := templates.SystemdSwap(what, priority, service)
+	if err != nil {
+		return fmt.Errorf("failed to format swap unit contents: %v", err)
+	}
+
+	g.Units = append(g.Units, ignitionTypes.Unit{
+		Name:     escapeUnitPath(what) + ".swap",
+		Enabled:  toPtr(true),
+		Contents: toPtr(contents),
+	})
+
+	return nil
+}
+
+func generateZram(swap *config.Swap, g *generator) error {
+	zram := *swap
+	if zram.RAMFraction == 0 {
+		zram.RAMFraction = defaultZramFraction
+	}
+
+	contents, err := templates.ZramGeneratorConfig(zram)
+	if err != nil {
+		return fmt.Errorf("failed to format zram-generator config: %v", err)
+	}
+
+	g.Files = append(g.Files, ignitionTypes.File{
+		Node: ignitionTypes.Node{
+			Path:      "/etc/systemd/zram-generator.conf",
+			Overwrite: toPtr(true),
+		},
+		FileEmbedded1: ignitionTypes.FileEmbedded1{
+			Mode: toPtr(0644),
+			Contents: ignitionTypes.Resource{
+				Source: toPtr(toDataUrl(contents)),
+			},
+		},
+	})
+
+	return nil
+}
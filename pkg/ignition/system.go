@@ -1,6 +1,9 @@
 package ignition
 
 import (
+	"fmt"
+	"strings"
+
 	ignitionTypes "github.com/coreos/ignition/v2/config/v3_4/types"
 	"github.com/tmacro/cola/internal/files"
 	"github.com/tmacro/cola/pkg/config"
@@ -25,6 +28,61 @@ func generateHostname(cfg *config.ApplianceConfig, g *generator) error {
 	return nil
 }
 
+func generateTimezone(cfg *config.ApplianceConfig, g *generator) error {
+	if cfg.System.Timezone == "" {
+		return nil
+	}
+
+	if !config.ValidTimezone(cfg.System.Timezone) {
+		return fmt.Errorf("unknown timezone %q", cfg.System.Timezone)
+	}
+
+	g.Links = append(g.Links, ignitionTypes.Link{
+		Node: ignitionTypes.Node{
+			Path:      "/etc/localtime",
+			Overwrite: toPtr(true),
+		},
+		LinkEmbedded1: ignitionTypes.LinkEmbedded1{
+			Hard:   toPtr(false),
+			Target: toPtr("../usr/share/zoneinfo/" + cfg.System.Timezone),
+		},
+	})
+
+	return nil
+}
+
+func generateTimesyncdConfig(cfg *config.ApplianceConfig, g *generator) error {
+	timesyncd := cfg.System.Timesyncd
+	if timesyncd == nil {
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("[Time]\n")
+	if len(timesyncd.Servers) > 0 {
+		fmt.Fprintf(&b, "NTP=%s\n", strings.Join(timesyncd.Servers, " "))
+	}
+
+	if len(timesyncd.FallbackServers) > 0 {
+		fmt.Fprintf(&b, "FallbackNTP=%s\n", strings.Join(timesyncd.FallbackServers, " "))
+	}
+
+	g.Files = append(g.Files, ignitionTypes.File{
+		Node: ignitionTypes.Node{
+			Path:      "/etc/systemd/timesyncd.conf.d/10-cola.conf",
+			Overwrite: toPtr(true),
+		},
+		FileEmbedded1: ignitionTypes.FileEmbedded1{
+			Mode: toPtr(0644),
+			Contents: ignitionTypes.Resource{
+				Source: toPtr(toDataUrl(b.String())),
+			},
+		},
+	})
+
+	return nil
+}
+
 func generateUpdateConfig(cfg *config.ApplianceConfig, g *generator) error {
 	if cfg.System.Updates != nil {
 		g.Files = append(g.Files, ignitionTypes.File{
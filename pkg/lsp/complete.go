@@ -0,0 +1,324 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/tmacro/cola/pkg/config"
+)
+
+var (
+	// referencePattern matches a partial reference to a variable or local.
+	referencePattern = regexp.MustCompile(`\b(var|local)\.[\w-]*$`)
+	// valuePattern matches a partial string value of an attribute.
+	valuePattern = regexp.MustCompile(`^\s*([\w-]+)\s*=\s*("?)[\w-]*$`)
+	// namePattern matches a partial attribute or block type.
+	namePattern = regexp.MustCompile(`^\s*[\w-]*$`)
+)
+
+// blockPath returns the types of the blocks enclosing offset, outermost
+// first. It only looks at tokens so that it works while the document does not
+// parse. Object expressions are included as an empty type.
+func blockPath(tokens hclsyntax.Tokens, offset int) []string {
+	path := make([]string, 0)
+	lineStart := 0
+	for i, tok := range tokens {
+		if tok.Range.Start.Byte >= offset {
+			break
+		}
+
+		switch tok.Type {
+		case hclsyntax.TokenNewline:
+			lineStart = i + 1
+		case hclsyntax.TokenOBrace:
+			path = append(path, blockHeader(tokens[lineStart:i]))
+		case hclsyntax.TokenCBrace:
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		}
+	}
+
+	return path
+}
+
+// blockHeader returns the type of the block opened by a line, e.g.
+// `container "web"`, or "" if the line does not open a block.
+func blockHeader(tokens hclsyntax.Tokens) string {
+	if len(tokens) == 0 || tokens[0].Type != hclsyntax.TokenIdent {
+		return ""
+	}
+
+	for _, tok := range tokens[1:] {
+		switch tok.Type {
+		case hclsyntax.TokenIdent, hclsyntax.TokenOQuote, hclsyntax.TokenQuotedLit, hclsyntax.TokenCQuote:
+		default:
+			return ""
+		}
+	}
+
+	return string(tokens[0].Bytes)
+}
+
+// specAt returns the spec of the block at path, or nil if there is none.
+func specAt(path []string) *config.BlockSpec {
+	spec := config.Spec()
+	for _, blockType := range path {
+		var nested *config.BlockSpec
+		for _, block := range spec.Blocks {
+			if block.Type == blockType {
+				nested = block
+				break
+			}
+		}
+
+		if nested == nil {
+			return nil
+		}
+
+		spec = nested
+	}
+
+	return spec
+}
+
+// tokenAt returns the index of the token holding offset, or -1. A token
+// ending at offset also counts, so that the word before the cursor is found.
+// Where two tokens touch the cursor, an identifier is preferred, e.g. name
+// rather than the dot before it when the cursor is at the start of var.name.
+func tokenAt(tokens hclsyntax.Tokens, offset int) int {
+	found := -1
+	for i, tok := range tokens {
+		if tok.Range.Start.Byte > offset {
+			break
+		}
+
+		if offset > tok.Range.End.Byte || tok.Type == hclsyntax.TokenNewline || tok.Type == hclsyntax.TokenEOF {
+			continue
+		}
+
+		if tok.Type == hclsyntax.TokenIdent {
+			return i
+		}
+
+		if found < 0 {
+			found = i
+		}
+	}
+
+	return found
+}
+
+func (s *Server) completion(params textDocumentPositionParams) (any, error) {
+	uri := params.TextDocument.URI
+	path, err := uriToPath(uri)
+	if err != nil || isJSON(path) {
+		return nil, nil
+	}
+
+	src := []byte(s.documents[uri])
+	off := offset(src, params.Position)
+	line := lineBefore(src, off)
+	tokens, _ := hclsyntax.LexConfig(src, path, hcl.InitialPos)
+
+	if match := referencePattern.FindStringSubmatch(line); match != nil {
+		return s.referenceCompletions(path, match[1]), nil
+	}
+
+	spec := specAt(blockPath(tokens, off-len(line)))
+	if spec == nil {
+		return nil, nil
+	}
+
+	if match := valuePattern.FindStringSubmatch(line); match != nil {
+		return valueCompletions(spec, match[1], match[2] != ""), nil
+	}
+
+	if namePattern.MatchString(line) {
+		return s.nameCompletions(spec), nil
+	}
+
+	return nil, nil
+}
+
+func (s *Server) referenceCompletions(path, root string) []completionItem {
+	items := make([]completionItem, 0)
+	for ref := range s.definitions(path) {
+		name, ok := strings.CutPrefix(ref, root+".")
+		if !ok {
+			continue
+		}
+
+		items = append(items, completionItem{
+			Label:  name,
+			Kind:   completionKindVariable,
+			Detail: ref,
+		})
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+
+	return items
+}
+
+func valueCompletions(spec *config.BlockSpec, name string, quoted bool) []completionItem {
+	items := make([]completionItem, 0)
+	for _, attr := range spec.Attrs {
+		if attr.Name != name {
+			continue
+		}
+
+		for _, value := range attr.Enum {
+			item := completionItem{Label: value, Kind: completionKindValue}
+			if !quoted {
+				item.InsertText = fmt.Sprintf("%q", value)
+			}
+
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func (s *Server) nameCompletions(spec *config.BlockSpec) []completionItem {
+	items := make([]completionItem, 0, len(spec.Attrs)+len(spec.Blocks))
+	for _, attr := range spec.Attrs {
+		items = append(items, completionItem{
+			Label:         attr.Name,
+			Kind:          completionKindField,
+			Detail:        attrDetail(attr),
+			Documentation: markdown(attr.Description),
+			InsertText:    attr.Name + " = ",
+		})
+	}
+
+	for _, block := range spec.Blocks {
+		item := completionItem{
+			Label:         block.Type,
+			Kind:          completionKindModule,
+			Detail:        blockDetail(block),
+			Documentation: markdown(block.Description),
+		}
+
+		if s.snippets {
+			item.InsertTextFormat = insertTextFormatSnippet
+			if block.Label != "" {
+				item.InsertText = fmt.Sprintf("%s \"${1:%s}\" {\n\t$0\n}", block.Type, block.Label)
+			} else {
+				item.InsertText = fmt.Sprintf("%s {\n\t$0\n}", block.Type)
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	return items
+}
+
+func (s *Server) hover(params textDocumentPositionParams) (any, error) {
+	uri := params.TextDocument.URI
+	path, err := uriToPath(uri)
+	if err != nil || isJSON(path) {
+		return nil, nil
+	}
+
+	src := []byte(s.documents[uri])
+	tokens, _ := hclsyntax.LexConfig(src, path, hcl.InitialPos)
+	i := tokenAt(tokens, offset(src, params.Position))
+	if i < 0 || tokens[i].Type != hclsyntax.TokenIdent {
+		return nil, nil
+	}
+
+	// Only the first word of a line names an attribute or block type.
+	if i > 0 && tokens[i-1].Type != hclsyntax.TokenNewline {
+		return nil, nil
+	}
+
+	tok := tokens[i]
+	spec := specAt(blockPath(tokens, tok.Range.Start.Byte))
+	if spec == nil {
+		return nil, nil
+	}
+
+	name := string(tok.Bytes)
+	rng := lspRange(tok.Range)
+
+	for _, attr := range spec.Attrs {
+		if attr.Name == name {
+			return hover{Contents: *markdown(attrHover(attr)), Range: &rng}, nil
+		}
+	}
+
+	for _, block := range spec.Blocks {
+		if block.Type == name {
+			return hover{Contents: *markdown(blockHover(block)), Range: &rng}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func attrDetail(attr config.AttrSpec) string {
+	detail := typeexpr.TypeString(attr.Type)
+	if attr.Required {
+		detail += ", required"
+	}
+
+	return detail
+}
+
+func blockDetail(block *config.BlockSpec) string {
+	if block.Label != "" {
+		return fmt.Sprintf("block, labeled by %s", block.Label)
+	}
+
+	return "block"
+}
+
+func attrHover(attr config.AttrSpec) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s** `%s`", attr.Name, typeexpr.TypeString(attr.Type))
+	if attr.Required {
+		b.WriteString(" (required)")
+	}
+
+	if attr.Description != "" {
+		fmt.Fprintf(&b, "\n\n%s", attr.Description)
+	}
+
+	if len(attr.Enum) > 0 {
+		values := make([]string, len(attr.Enum))
+		for i, value := range attr.Enum {
+			values[i] = fmt.Sprintf("`%q`", value)
+		}
+
+		fmt.Fprintf(&b, "\n\nOne of: %s", strings.Join(values, ", "))
+	}
+
+	return b.String()
+}
+
+func blockHover(block *config.BlockSpec) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s** %s", block.Type, blockDetail(block))
+
+	if block.Description != "" {
+		fmt.Fprintf(&b, "\n\n%s", block.Description)
+	}
+
+	return b.String()
+}
+
+func markdown(value string) *markupContent {
+	if value == "" {
+		return nil
+	}
+
+	return &markupContent{Kind: "markdown", Value: value}
+}
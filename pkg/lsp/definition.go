@@ -0,0 +1,124 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/tmacro/cola/pkg/config"
+)
+
+var definitionSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "variable", LabelNames: []string{"name"}},
+		{Type: "locals"},
+	},
+}
+
+// definitions returns the ranges of the variables and locals visible from
+// the document at path, keyed by their reference, e.g. var.name. They are
+// read from the config files in the directory of the document, using the
+// text of open documents where there is one.
+func (s *Server) definitions(path string) map[string]hcl.Range {
+	defs := make(map[string]hcl.Range)
+
+	dir := filepath.Dir(path)
+	files, err := config.ConfigFiles([]string{dir})
+	if err != nil {
+		return defs
+	}
+
+	for _, file := range files {
+		src, ok := s.documentText(file)
+		if !ok {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				continue
+			}
+
+			src = string(data)
+		}
+
+		parsed, _ := parseSource([]byte(src), file)
+		content, _, _ := parsed.Body.PartialContent(definitionSchema)
+
+		// Files in subdirectories are read as part of the same config, but
+		// definitions next to the document take precedence.
+		define := func(ref string, rng hcl.Range) {
+			if _, ok := defs[ref]; !ok || filepath.Dir(file) == dir {
+				defs[ref] = rng
+			}
+		}
+
+		for _, block := range content.Blocks {
+			switch block.Type {
+			case "variable":
+				if len(block.Labels) == 0 {
+					continue
+				}
+
+				define("var."+block.Labels[0], block.DefRange)
+			case "locals":
+				attrs, _ := block.Body.JustAttributes()
+				for name, attr := range attrs {
+					define("local."+name, attr.NameRange)
+				}
+			}
+		}
+	}
+
+	return defs
+}
+
+// reference returns the variable or local referenced by the traversal the
+// i-th token is part of, e.g. var.name, or "" if there is none.
+func reference(tokens hclsyntax.Tokens, i int) string {
+	if tokens[i].Type != hclsyntax.TokenIdent {
+		return ""
+	}
+
+	var root, name hclsyntax.Token
+	switch {
+	case i >= 2 && tokens[i-1].Type == hclsyntax.TokenDot && tokens[i-2].Type == hclsyntax.TokenIdent:
+		root, name = tokens[i-2], tokens[i]
+	case i+2 < len(tokens) && tokens[i+1].Type == hclsyntax.TokenDot && tokens[i+2].Type == hclsyntax.TokenIdent:
+		root, name = tokens[i], tokens[i+2]
+	default:
+		return ""
+	}
+
+	switch string(root.Bytes) {
+	case "var", "local":
+		return string(root.Bytes) + "." + string(name.Bytes)
+	}
+
+	return ""
+}
+
+func (s *Server) definition(params textDocumentPositionParams) (any, error) {
+	uri := params.TextDocument.URI
+	path, err := uriToPath(uri)
+	if err != nil || isJSON(path) {
+		return nil, nil
+	}
+
+	src := []byte(s.documents[uri])
+	tokens, _ := hclsyntax.LexConfig(src, path, hcl.InitialPos)
+	i := tokenAt(tokens, offset(src, params.Position))
+	if i < 0 {
+		return nil, nil
+	}
+
+	ref := reference(tokens, i)
+	if ref == "" {
+		return nil, nil
+	}
+
+	rng, ok := s.definitions(path)[ref]
+	if !ok {
+		return nil, nil
+	}
+
+	return location{URI: pathToURI(rng.Filename), Range: lspRange(rng)}, nil
+}
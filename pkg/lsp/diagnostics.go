@@ -0,0 +1,131 @@
+package lsp
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/tmacro/cola/pkg/config"
+)
+
+// check publishes the diagnostics of a document. Syntax errors are reported
+// from the text of the document as it is edited. When full is set, the
+// config the document belongs to is read from disk and validated, which is
+// done once changes are saved; until then, the results of the last full check
+// are kept.
+func (s *Server) check(uri string, full bool) error {
+	path, err := uriToPath(uri)
+	if err != nil {
+		return err
+	}
+
+	if !isDocument(path) {
+		return nil
+	}
+
+	_, diags := parseSource([]byte(s.documents[uri]), path)
+	if diags.HasErrors() {
+		return s.publish(uri, convertDiagnostics(diags, uri, path)[uri])
+	}
+
+	// Without --config, the directory of the document is read, or the
+	// config including it if the document belongs to a module.
+	paths := s.configPaths
+	if len(paths) == 0 {
+		paths = []string{config.ModuleRoot(filepath.Dir(path))}
+	}
+
+	key := strings.Join(paths, "\x00")
+	if !full {
+		return s.publish(uri, s.published[key][uri])
+	}
+
+	results := convertDiagnostics(readDiagnostics(paths, s.valueFiles, s.readOpts), uri, path)
+
+	// Documents with diagnostics from the previous check, and the document
+	// being checked, are cleared if they no longer have any.
+	for previous := range s.published[key] {
+		if _, ok := results[previous]; !ok {
+			results[previous] = nil
+		}
+	}
+
+	if _, ok := results[uri]; !ok {
+		results[uri] = nil
+	}
+
+	s.published[key] = results
+
+	for target, diags := range results {
+		if err := s.publish(target, diags); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) publish(uri string, diags []diagnostic) error {
+	if diags == nil {
+		diags = make([]diagnostic, 0)
+	}
+
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: diags,
+	})
+}
+
+// readDiagnostics reads and validates a config, returning all problems found
+// as diagnostics.
+func readDiagnostics(paths, values []string, opts []config.ReadOpt) hcl.Diagnostics {
+	cfg, err := config.ReadConfig(paths, values, opts...)
+	if err != nil {
+		var diags hcl.Diagnostics
+		if errors.As(err, &diags) {
+			return diags
+		}
+
+		return hcl.Diagnostics{{Severity: hcl.DiagError, Summary: err.Error()}}
+	}
+
+	return config.ValidateConfig(cfg)
+}
+
+// convertDiagnostics converts HCL diagnostics to LSP diagnostics, grouped
+// by document URI. Diagnostics in the file at path, or without a subject,
+// are reported against uri, the latter at the start of the document.
+func convertDiagnostics(diags hcl.Diagnostics, uri, path string) map[string][]diagnostic {
+	results := make(map[string][]diagnostic)
+	for _, diag := range diags {
+		target := uri
+		var rng textRange
+		if diag.Subject != nil {
+			if filepath.Clean(diag.Subject.Filename) != path {
+				target = pathToURI(diag.Subject.Filename)
+			}
+
+			rng = lspRange(*diag.Subject)
+		}
+
+		severity := severityError
+		if diag.Severity == hcl.DiagWarning {
+			severity = severityWarning
+		}
+
+		message := diag.Summary
+		if diag.Detail != "" {
+			message += ": " + diag.Detail
+		}
+
+		results[target] = append(results[target], diagnostic{
+			Range:    rng,
+			Severity: severity,
+			Source:   "cola",
+			Message:  message,
+		})
+	}
+
+	return results
+}
@@ -0,0 +1,119 @@
+package lsp
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	hcljson "github.com/hashicorp/hcl/v2/json"
+)
+
+func uriToPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported document URI: %s", uri)
+	}
+
+	return filepath.Clean(filepath.FromSlash(u.Path)), nil
+}
+
+func pathToURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// documentText returns the text of the open document at path.
+func (s *Server) documentText(path string) (string, bool) {
+	for uri, text := range s.documents {
+		if docPath, err := uriToPath(uri); err == nil && docPath == filepath.Clean(path) {
+			return text, true
+		}
+	}
+
+	return "", false
+}
+
+// documentExtensions are the extensions of the config and value files in
+// HCL syntax handled by the server.
+var documentExtensions = []string{".hcl", ".hcl.json", ".cvars", ".cvars.json", ".tfvars", ".tfvars.json"}
+
+func isDocument(path string) bool {
+	for _, ext := range documentExtensions {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isJSON reports whether a document is written in the JSON syntax of HCL.
+func isJSON(path string) bool {
+	return strings.HasSuffix(path, ".json")
+}
+
+// parseSource parses the text of a document. The returned file is never nil,
+// its body holds whatever could be parsed.
+func parseSource(src []byte, path string) (*hcl.File, hcl.Diagnostics) {
+	var file *hcl.File
+	var diags hcl.Diagnostics
+	if isJSON(path) {
+		file, diags = hcljson.Parse(src, path)
+	} else {
+		file, diags = hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+	}
+
+	if file == nil {
+		file = &hcl.File{Body: hcl.EmptyBody(), Bytes: src}
+	}
+
+	return file, diags
+}
+
+// offset returns the byte offset of pos in src. Characters are counted in
+// UTF-16 code units, as in all LSP positions.
+func offset(src []byte, pos position) int {
+	i := 0
+	for line := 0; line < pos.Line && i < len(src); i++ {
+		if src[i] == '\n' {
+			line++
+		}
+	}
+
+	for units := 0; units < pos.Character && i < len(src) && src[i] != '\n'; {
+		r, size := utf8.DecodeRune(src[i:])
+		units += utf16.RuneLen(r)
+		i += size
+	}
+
+	return i
+}
+
+// lineBefore returns the text of the line holding offset, up to offset.
+func lineBefore(src []byte, offset int) string {
+	start := strings.LastIndexByte(string(src[:offset]), '\n') + 1
+	return string(src[start:offset])
+}
+
+func lspRange(rng hcl.Range) textRange {
+	return textRange{
+		Start: lspPosition(rng.Start),
+		End:   lspPosition(rng.End),
+	}
+}
+
+func lspPosition(pos hcl.Pos) position {
+	return position{Line: max(pos.Line-1, 0), Character: max(pos.Column-1, 0)}
+}
@@ -0,0 +1,291 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tmacro/cola/pkg/config"
+)
+
+var (
+	ErrExitWithoutShutdown = fmt.Errorf("exit requested before shutdown")
+)
+
+type ServerOpt func(*Server)
+
+// WithConfig sets the config files or directories read for diagnostics. By
+// default, the directory of the document being checked is read.
+func WithConfig(paths []string) ServerOpt {
+	return func(s *Server) {
+		s.configPaths = paths
+	}
+}
+
+// WithValueFiles sets the files containing variable values.
+func WithValueFiles(paths []string) ServerOpt {
+	return func(s *Server) {
+		s.valueFiles = paths
+	}
+}
+
+// WithReadOpts sets the options passed to config.ReadConfig.
+func WithReadOpts(opts ...config.ReadOpt) ServerOpt {
+	return func(s *Server) {
+		s.readOpts = opts
+	}
+}
+
+// Server is a language server for config files, speaking JSON-RPC over a
+// pair of streams.
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	configPaths []string
+	valueFiles  []string
+	readOpts    []config.ReadOpt
+
+	// documents holds the text of the open documents, keyed by URI.
+	documents map[string]string
+	// published holds the diagnostics of the last check of each config,
+	// keyed by config and then by document URI.
+	published map[string]map[string][]diagnostic
+	snippets  bool
+	shutdown  bool
+}
+
+func NewServer(in io.Reader, out io.Writer, opts ...ServerOpt) *Server {
+	s := &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: make(map[string]string),
+		published: make(map[string]map[string][]diagnostic),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Run handles messages until the client exits or closes the input stream.
+func (s *Server) Run() error {
+	for {
+		msg, err := s.read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return ErrExitWithoutShutdown
+			}
+
+			return nil
+		}
+
+		log.Debug().Str("method", msg.Method).Msg("Handling message")
+
+		result, err := s.handle(msg)
+		if msg.ID == nil {
+			if err != nil {
+				log.Warn().Err(err).Str("method", msg.Method).Msg("Failed to handle notification")
+			}
+
+			continue
+		}
+
+		if err := s.respond(msg.ID, result, err); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg *message) (any, error) {
+	switch msg.Method {
+	case "initialize":
+		var params initializeParams
+		if err := decodeParams(msg.Params, &params); err != nil {
+			return nil, err
+		}
+
+		s.snippets = params.Capabilities.TextDocument.Completion.CompletionItem.SnippetSupport
+
+		return initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync: textDocumentSyncOptions{
+					OpenClose: true,
+					Change:    textDocumentSyncFull,
+					Save:      saveOptions{IncludeText: true},
+				},
+				CompletionProvider: completionOptions{TriggerCharacters: []string{"."}},
+				HoverProvider:      true,
+				DefinitionProvider: true,
+			},
+			ServerInfo: serverInfo{Name: "cola"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := decodeParams(msg.Params, &params); err != nil {
+			return nil, err
+		}
+
+		s.documents[params.TextDocument.URI] = params.TextDocument.Text
+
+		return nil, s.check(params.TextDocument.URI, true)
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := decodeParams(msg.Params, &params); err != nil {
+			return nil, err
+		}
+
+		// With full sync, the last change holds the whole document.
+		if n := len(params.ContentChanges); n > 0 {
+			s.documents[params.TextDocument.URI] = params.ContentChanges[n-1].Text
+		}
+
+		return nil, s.check(params.TextDocument.URI, false)
+	case "textDocument/didSave":
+		var params didSaveParams
+		if err := decodeParams(msg.Params, &params); err != nil {
+			return nil, err
+		}
+
+		if params.Text != nil {
+			s.documents[params.TextDocument.URI] = *params.Text
+		}
+
+		return nil, s.check(params.TextDocument.URI, true)
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := decodeParams(msg.Params, &params); err != nil {
+			return nil, err
+		}
+
+		delete(s.documents, params.TextDocument.URI)
+
+		return nil, nil
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err := decodeParams(msg.Params, &params); err != nil {
+			return nil, err
+		}
+
+		return s.completion(params)
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err := decodeParams(msg.Params, &params); err != nil {
+			return nil, err
+		}
+
+		return s.hover(params)
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if err := decodeParams(msg.Params, &params); err != nil {
+			return nil, err
+		}
+
+		return s.definition(params)
+	}
+
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+}
+
+func decodeParams(params json.RawMessage, v any) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+
+	return nil
+}
+
+// read reads a message, framed by a Content-Length header.
+func (s *Server) read() (*message, error) {
+	length := -1
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid Content-Length header: %w", err)
+			}
+		}
+	}
+
+	if length < 0 {
+		return nil, fmt.Errorf("missing Content-Length header")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+
+	return &msg, nil
+}
+
+func (s *Server) write(v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (s *Server) respond(id *json.RawMessage, result any, err error) error {
+	resp := response{JSONRPC: "2.0", ID: id}
+	if err != nil {
+		var respErr *responseError
+		if !errors.As(err, &respErr) {
+			respErr = &responseError{Code: codeInternalError, Message: err.Error()}
+		}
+
+		resp.Error = respErr
+		return s.write(resp)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	resp.Result = data
+	return s.write(resp)
+}
+
+func (s *Server) notify(method string, params any) error {
+	return s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}